@@ -17,17 +17,14 @@
 package main
 
 import (
-	"bytes"
-	"fmt"
-	"io/ioutil"
+	"errors"
 	"log"
-	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
+	"github.com/emschu/archivebox-quick-add/archivebox"
 )
 
 func isURL(inputStr string) bool {
@@ -44,264 +41,203 @@ func isURL(inputStr string) bool {
 	return false
 }
 
-func doArchiveBoxLogin() {
-	pw := fyneApplication.Preferences().StringWithFallback(preferencePassword, "")
-	username := fyneApplication.Preferences().StringWithFallback(preferenceUsername, "")
-
-	paramStr := fmt.Sprintf("csrfmiddlewaretoken=%s&username=%s&password=%s&next=%%2F",
-		appSessionState.CsrfMiddlewareToken, url.QueryEscape(username), url.QueryEscape(pw))
-	buffer := bytes.NewBuffer([]byte(paramStr))
-
-	request, err := buildPostRequest("/admin/login/?next=", buffer)
-
-	transport := http.Transport{}
-	do, err := transport.RoundTrip(request)
-	if err != nil {
-		panic(err)
-	}
-	defer do.Body.Close()
-
-	if do.StatusCode != 302 {
-		// something went wrong
-		log.Printf("Problem with login! Got status %d\n", do.StatusCode)
-		appSessionState.SessionCookie = nil
-		return
-	}
-
-	for _, i := range do.Cookies() {
-		if i.Name == "sessionid" {
-			appSessionState.SessionCookie = i
-			log.Printf("Session id is set successfully")
-			appSessionState.IsConnected = true
-			break
-		}
-	}
-}
-
-func doArchiveBoxLogout() {
-	if appSessionState.SessionCookie == nil || appSessionState.CsrfToken == nil {
-		// there was no login
-		return
-	}
-
-	request, err := buildGetRequest("/admin/logout")
-	if err != nil {
-		log.Printf("Error creating logout request\n")
-		return
-	}
-
-	get, err := httpClient.Do(request)
-	if err != nil {
-		log.Printf("Logout request failed!:%v\n", err)
-		return
-	}
-	if get.StatusCode == 200 {
-		log.Printf("Logout\n")
-	} else {
-		log.Printf("Logout not successful\n")
-	}
-	defer get.Body.Close()
-}
-
-func buildGetRequest(apiPath string) (*http.Request, error) {
-	request, err := http.NewRequest("GET", fmt.Sprintf("%s%s", appConfig.InstanceURL, apiPath), nil)
-	if err != nil {
-		panic(err)
-	}
-
-	if appSessionState.CsrfToken != nil {
-		request.AddCookie(appSessionState.CsrfToken)
-	}
-	if appSessionState.SessionCookie != nil {
-		request.AddCookie(appSessionState.SessionCookie)
-	}
-	return request, err
-}
-
-func buildPostRequest(apiPath string, requestData *bytes.Buffer) (*http.Request, error) {
-	request, err := http.NewRequest("POST", fmt.Sprintf("%s%s", appConfig.InstanceURL, apiPath), requestData)
-	if err != nil {
-		panic(err)
-	}
-	request.Header.Set("Cache-Control", "max-age=0, no-cache, no-store, must-revalidate, private")
-	request.Header.Set("Host", appConfig.InstanceURL)
-	request.Header.Set("Origin", appConfig.InstanceURL)
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	request.Header.Set("Content-Length", "0")
-	if appSessionState.CsrfToken != nil {
-		request.AddCookie(appSessionState.CsrfToken)
-	}
-	if appSessionState.SessionCookie != nil {
-		request.AddCookie(appSessionState.SessionCookie)
-	}
-
-	return request, nil
-}
-
-func setupArchiveBoxConnection() {
-	if len(strings.TrimSpace(appConfig.InstanceURL)) == 0 {
-		appSessionState.ConnectionErr = fmt.Errorf("invalid empty url to archivebox")
-		appConfig.disconnect()
-		return
-	}
-	if !isURL(appConfig.InstanceURL) {
-		appSessionState.ConnectionErr = fmt.Errorf("url does not start with 'http[s]://'")
-		appConfig.disconnect()
-		return
-	}
+// timeouts of requests to archivebox
+const (
+	requestTimeout = 10 * time.Second
+	searchTimeout  = 30 * time.Second // searching the archive can take a while
+)
 
-	adminResp, err := httpClient.Get(fmt.Sprintf("%s/admin/login", appConfig.InstanceURL))
+// connect to the instance of the active profile, a failure is shown in the window
+func setupArchiveBoxConnection() error {
+	err := primarySession().connect()
 	if err != nil {
-		appSessionState.ConnectionErr = err
-		appConfig.disconnect()
-		return
-	}
-	defer adminResp.Body.Close()
-
-	for _, c := range adminResp.Cookies() {
-		if c.Name == "csrftoken" {
-			if len(c.Value) > 0 {
-				appSessionState.CsrfToken = c
-			}
-			if isDebug {
-				log.Printf("csrf token: %v\n", c.Value)
+		appConfig.disconnect(err)
+	} else if capabilities := primarySession().capabilities(); !capabilities.IsSupported() && infoLabel != nil {
+		fyne.Do(func() {
+			infoLabel.SetText(tWithArgs("UnsupportedVersion", struct {
+				Version string
+				Min     string
+				Max     string
+			}{Version: capabilities.Version.String(), Min: archivebox.MinSupportedVersion.String(),
+				Max: archivebox.FirstUnsupportedVersion.String()}))
+		})
+	}
+	if instanceLink != nil {
+		// the connection setup may have chosen an alternative url of the instance
+		fyne.Do(updateInstanceLink)
+	}
+	if diagnoseBtn != nil {
+		fyne.Do(func() {
+			if err != nil {
+				diagnoseBtn.Show()
+			} else {
+				diagnoseBtn.Hide()
 			}
-		}
-	}
-	pattern := regexp.MustCompile("name=\"csrfmiddlewaretoken\" value=\"(.*?)\"")
-	all, err := ioutil.ReadAll(adminResp.Body)
-	if err != nil {
-		csrfErrMsg := "Cannot find csrfmiddlewaretoken!"
-		log.Println(csrfErrMsg)
-		appSessionState.ConnectionErr = fmt.Errorf("%s", csrfErrMsg)
-		appConfig.disconnect()
-		return
-	}
-	if len(strings.TrimSpace(string(all))) > 0 {
-		match := pattern.FindStringSubmatch(string(all))
-		if len(match) > 1 && len(match[1]) > 0 {
-			appSessionState.CsrfMiddlewareToken = strings.TrimSpace(match[1])
-		} else {
-			log.Printf("Problem finding csrfmiddlewaretoken!\n")
-		}
-	}
-	if isDebug {
-		log.Printf("csrfmiddlewaretoken: %s\n", appSessionState.CsrfMiddlewareToken)
-	}
-
-	if appSessionState.SessionCookie == nil {
-		if len(appSessionState.CsrfMiddlewareToken) > 0 && appSessionState.CsrfToken != nil {
-			doArchiveBoxLogin()
-		} else {
-			log.Printf("Cannot start login")
-		}
+		})
 	}
+	return err
 }
 
 func isURLAlreadyArchived(urlToCheck string) bool {
 	urlToCheck = strings.TrimSpace(urlToCheck)
-	if !appSessionState.IsConnected {
+	if isConnected, _ := primarySession().status(); !isConnected || primarySession().isAnonymous() {
 		return false
 	}
 	// validate url at first
 	if len(urlToCheck) < 5 || !isURL(urlToCheck) {
 		return false
 	}
-
-	snapshotSearchPath := fmt.Sprintf("/admin/core/snapshot/?q=%s", url.QueryEscape(urlToCheck))
-
-	request, err := buildGetRequest(snapshotSearchPath)
-	if err != nil {
-		log.Printf("Problem creating request\n")
-		return false
-	}
-
-	// use a higher another client timeout value to wait for search results
-	do, err := archiveSearchHTTPClient.Do(request)
+	snapshot, err := findSnapshot(urlToCheck)
 	if err != nil {
-		log.Printf("Problem fetching snapshot search page: %v\n", err)
+		log.Printf("Problem searching snapshot: %v\n", err)
 		return false
 	}
-	defer do.Body.Close()
-
-	content, err := ioutil.ReadAll(do.Body)
-	if err != nil {
-		log.Printf("Problem reading response body:%s\n", err.Error())
-		return false
-	}
-
-	// check if result size is zero
-	pattern := regexp.MustCompile("<span class=\"small quiet\">0 results \\(<a href=\"?\">[0-9]+ total</a>\\)</span>")
-	if pattern.Match(content) {
-		return false
-	}
-	return true
+	return snapshot != nil
 }
 
-func sendURLToArchiveBox(urlToSave string) (bool, error) {
-	setupArchiveBoxConnection()
-	urlToSave = strings.TrimSpace(urlToSave)
-	if !appSessionState.IsConnected {
-		return false, fmt.Errorf("%s", t("NoConnectionToInstance"))
-	}
-
-	// validate url at first
-	if len(urlToSave) < 5 {
-		return false, fmt.Errorf("%s", t("URLTooShort"))
-	}
-	if !isURL(urlToSave) {
-		return false, fmt.Errorf("%s", t("InvalidURL"))
+// translated description of errors of the archivebox client
+func localizeError(err error) string {
+	var authErr *archivebox.AuthenticationError
+	var statusErr *archivebox.StatusError
+	var connErr *archivebox.ConnectionError
+	switch {
+	case errors.Is(err, errCredentialsLocked):
+		return t("CredentialsLocked")
+	case errors.Is(err, errWrongPassphrase):
+		return t("WrongPassphrase")
+	case errors.Is(err, archivebox.ErrPublicAddDisabled):
+		return t("PublicAddDisabled")
+	case errors.Is(err, archivebox.ErrNotArchiveBox):
+		return t("NotArchiveBox")
+	case errors.As(err, &authErr):
+		return t("LoginFailed")
+	case errors.As(err, &statusErr):
+		return tWithArgs("UnexpectedStatusCode", struct {
+			Code int
+		}{Code: statusErr.StatusCode})
+	case errors.As(err, &connErr):
+		instanceURL := connErr.InstanceURL
+		if len(instanceURL) == 0 {
+			instanceURL = appConfig.InstanceURL
+		}
+		return tWithArgs("ProblemCallingArchiveBox", struct {
+			URL string
+		}{URL: instanceURL}) + " " + connErr.Err.Error()
+	default:
+		return err.Error()
 	}
+}
 
-	buffer := bytes.NewBuffer([]byte(fmt.Sprintf("csrfmiddlewaretoken=%s&url=%s&parser=auto&tag=&depth=0",
-		appSessionState.CsrfMiddlewareToken, url.QueryEscape(urlToSave))))
-	request, err := buildPostRequest("/add/", buffer)
-	if err != nil {
-		panic(err)
-	}
-	transport := http.Transport{}
+// options of a submission to the add form of archivebox
+type submissionOptions struct {
+	Tags  []string `json:"tags,omitempty"`
+	Depth int      `json:"depth"`
+	// empty to use all archive methods enabled on the server
+	ArchiveMethods []string `json:"archive_methods,omitempty"`
+	Parser         string   `json:"parser,omitempty"`
+	// additional urls submitted together with the main url, e.g. selected outlinks
+	ExtraURLs []string `json:"extra_urls,omitempty"`
+}
 
-	// the endpoint sometimes needs a lot of time (~60 secs) until there is a response
-	// therefore we 'cancel' the post request after 2 secs and ArchiveBox should have the request
-	transport.ResponseHeaderTimeout = 2 * time.Second // this should be enough time to wait for the request being processed by ArchiveBox
-	do, err := transport.RoundTrip(request)
-	if err != nil {
-		if strings.HasSuffix(err.Error(), "timeout awaiting response headers") {
-			// this is expected
-			return true, nil
-		}
-		msg := tWithArgs("ProblemCallingArchiveBox", struct {
-			URL string
-		}{URL: appConfig.InstanceURL})
-		log.Printf("%s\n", msg)
-		return false, fmt.Errorf("%s", msg)
+func (o submissionOptions) addOptions(urlToSave string) archivebox.AddOptions {
+	return archivebox.AddOptions{
+		URLs:           append([]string{urlToSave}, o.ExtraURLs...),
+		Tags:           o.Tags,
+		Depth:          o.Depth,
+		ArchiveMethods: o.ArchiveMethods,
+		Parser:         o.Parser,
 	}
-	defer do.Body.Close()
-	log.Printf("entry add response status: %v\n", do.StatusCode)
-	return true, nil
 }
 
 // should be non-blocking to be safe for ui, handles validation of input
 func archiveURL(urlInput string) {
 	setupArchiveBoxConnection()
 	urlInput = strings.TrimSpace(urlInput)
-	if appSessionState.IsSubmissionBlocked.isSet() {
+	if appSessionState.IsSubmissionBlocked.isSet() || appSessionState.IsBatchRunning.isSet() {
 		if isDebug {
 			log.Printf("Blocked submission of URL '%s'\n", urlInput)
 		}
 		return
 	}
+	options := submissionOptions{
+		Tags:           parseTags(tagEntryWidget.Text),
+		Depth:          selectedDepth(),
+		ArchiveMethods: selectedArchiveMethods,
+		Parser:         parserSelect.Selected,
+	}
 	infoLabel.Text = ""
+	if lines := splitInputLines(urlInput); isURLPerLine(lines) {
+		submitURLBatch(lines, options)
+		return
+	}
+	if !isURL(urlInput) {
+		// the input is arbitrary text, let the user pick the urls to archive
+		if foundURLs := extractURLs(urlInput); len(foundURLs) > 0 {
+			showURLSelectionDialog(t("FoundURLs"), t("FoundURLsDescription"), foundURLs, func(selectedURLs []string) {
+				if len(selectedURLs) == 1 {
+					submitURLWithOutlinks(selectedURLs[0], options)
+				} else if len(selectedURLs) > 1 {
+					submitURLBatch(selectedURLs, options)
+				}
+			})
+			return
+		}
+	}
+	submitURLWithOutlinks(urlInput, options)
+}
+
+// submits the url, with a depth above 0 after the user selected its outlinks in the preview
+func submitURLWithOutlinks(urlInput string, options submissionOptions) {
+	if options.Depth > 0 && isURL(urlInput) {
+		// outlinks are selected by the user and submitted explicitly instead of letting archivebox crawl all of them
+		showOutlinkPreview(urlInput, func(selectedOutlinks []string) {
+			options.Depth = 0
+			options.ExtraURLs = selectedOutlinks
+			submitURL(urlInput, options)
+		})
+		return
+	}
+	submitURL(urlInput, options)
+}
+
+func submitURL(urlInput string, options submissionOptions) {
 	log.Printf("Started URL archiving for url '%s'\n", urlInput)
 	go func() {
 		inputEntryWidget.Disable()
 		addToArchiveBtn.Disable()
-		hasWorked, err := sendURLToArchiveBox(urlInput)
+		// a url archived before gets no new snapshot, its existing one confirms the submission
+		var existingSnapshots []archivebox.Snapshot
+		if fyneApplication.Preferences().BoolWithFallback(preferenceConfirmSubmission, false) && isURL(urlInput) {
+			existingSnapshots = snapshotsBeforeSubmission(urlInput)
+		}
+		results := sendURLToInstances(urlInput, options, func(instanceURL string, attempt int, maxAttempts int, err error) {
+			fyne.Do(func() {
+				infoLabel.SetText(retryText(attempt, maxAttempts, err))
+			})
+		})
+		// the instance of the profile decides about notifications and confirmations, mirrors are reported in the info label
+		hasWorked, err := results[0].HasWorked, results[0].Err
 		if hasWorked {
 			// all went fine!
-			closeAppPref := fyneApplication.Preferences().BoolWithFallback(preferenceCloseAfterAdd, false)
+			closeAppPref := fyneApplication.Preferences().BoolWithFallback(preferenceCloseAfterAdd, false) &&
+				instanceFailure(results) == nil
 			checkAfterAddPref := fyneApplication.Preferences().BoolWithFallback(preferenceCheckAdd, false)
-			if checkAfterAddPref {
+			confirmPref := fyneApplication.Preferences().BoolWithFallback(preferenceConfirmSubmission, false)
+			if confirmPref {
+				// the app keeps running in background until the snapshot is confirmed
+				confirmSubmission(urlInput, existingSnapshots)
+				if len(existingSnapshots) == 0 {
+					fyne.Do(func() {
+						infoLabel.SetText(tWithArgs("WaitingForConfirmation", struct {
+							URL string
+						}{URL: urlInput}))
+					})
+				}
+				if closeAppPref {
+					quitApp()
+				}
+				inputEntryWidget.SetText("")
+			} else if checkAfterAddPref {
 				if isURLAlreadyArchived(urlInput) {
 					var urlString string
 					urlString, err = url.QueryUnescape(urlInput)
@@ -317,7 +253,7 @@ func archiveURL(urlInput string) {
 						}{URL: urlString}),
 					})
 					if closeAppPref {
-						fyneApplication.Quit()
+						quitApp()
 					}
 					inputEntryWidget.SetText("")
 				} else {
@@ -338,15 +274,25 @@ func archiveURL(urlInput string) {
 					}{URL: urlInput}),
 				})
 				if closeAppPref {
-					fyneApplication.Quit()
+					quitApp()
 				}
 				inputEntryWidget.SetText("")
 			}
 		}
-		if err != nil {
+		// keep the submission and send it when archivebox is reachable again
+		queued := queueUnreachableInstances(urlInput, options, results)
+		if len(results) > 1 {
+			infoLabel.Text = instanceResultsText(results)
+			if queued == len(results) {
+				inputEntryWidget.SetText("")
+			}
+		} else if queued > 0 {
+			infoLabel.Text = t("URLQueued")
+			inputEntryWidget.SetText("")
+		} else if err != nil {
 			infoLabel.Text = tWithArgs("ProblemAddingURL", struct {
 				ERROR string
-			}{ERROR: err.Error()})
+			}{ERROR: localizeError(err)})
 		}
 		infoLabel.Refresh()
 		inputEntryWidget.Enable()
@@ -0,0 +1,159 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// header used by the rest api of archivebox (v0.8+) to authenticate requests
+const apiKeyHeader = "X-ArchiveBox-API-Key"
+
+const (
+	apiCheckTokenPath = "/api/v1/auth/check_api_token"
+	apiAddPath        = "/api/v1/cli/add"
+	apiSnapshotsPath  = "/api/v1/core/snapshots"
+	apiTagsPath       = "/api/v1/core/tags"
+)
+
+type apiTokenCheckResponse struct {
+	Success bool `json:"success"`
+}
+
+type apiAddRequest struct {
+	URLs       []string `json:"urls"`
+	Tag        string   `json:"tag"`
+	Depth      int      `json:"depth"`
+	Parser     string   `json:"parser"`
+	Extractors string   `json:"extractors"`
+}
+
+type apiSnapshot struct {
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+	URL       string `json:"url"`
+}
+
+type apiSnapshotList struct {
+	Count int           `json:"count"`
+	Items []apiSnapshot `json:"items"`
+}
+
+type apiTag struct {
+	Name string `json:"name"`
+}
+
+func newAPIAddRequest(options AddOptions) apiAddRequest {
+	return apiAddRequest{
+		URLs:       options.URLs,
+		Tag:        strings.Join(options.Tags, ","),
+		Depth:      options.Depth,
+		Parser:     options.Parser,
+		Extractors: strings.Join(options.ArchiveMethods, ","),
+	}
+}
+
+// check the api key, returns false if the instance has no rest api
+func (c *Client) checkAPIKey(ctx context.Context) (bool, error) {
+	resp, err := c.postJSON(ctx, apiCheckTokenPath, map[string]string{"token": c.config.APIKey})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return false, &AuthenticationError{}
+	case resp.StatusCode != http.StatusOK:
+		return false, &StatusError{StatusCode: resp.StatusCode}
+	}
+	var checkResponse apiTokenCheckResponse
+	if err = json.NewDecoder(resp.Body).Decode(&checkResponse); err != nil {
+		return false, err
+	}
+	if !checkResponse.Success {
+		return false, &AuthenticationError{}
+	}
+	return true, nil
+}
+
+func (c *Client) postJSON(ctx context.Context, apiPath string, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	request, err := c.newRequest(ctx, http.MethodPost, apiPath, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/json")
+	return c.do(request)
+}
+
+func (c *Client) getJSON(ctx context.Context, apiPath string, target interface{}) error {
+	request, err := c.newRequest(ctx, http.MethodGet, apiPath, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	resp, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// filter is a filter parameter of the snapshot list, e.g. "url" or "search"
+func (c *Client) searchWithAPI(ctx context.Context, filter string, value string) ([]Snapshot, error) {
+	var snapshotList apiSnapshotList
+	query := url.Values{}
+	query.Set(filter, value)
+	if err := c.getJSON(ctx, apiSnapshotsPath+"?"+query.Encode(), &snapshotList); err != nil {
+		return nil, err
+	}
+	snapshots := make([]Snapshot, 0, len(snapshotList.Items))
+	for _, item := range snapshotList.Items {
+		snapshots = append(snapshots, Snapshot{ID: item.ID, Timestamp: item.Timestamp, URL: item.URL})
+	}
+	return snapshots, nil
+}
+
+func (c *Client) tagsWithAPI(ctx context.Context) ([]string, error) {
+	var tags []apiTag
+	if err := c.getJSON(ctx, apiTagsPath, &tags); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if len(strings.TrimSpace(tag.Name)) > 0 {
+			names = append(names, tag.Name)
+		}
+	}
+	return names, nil
+}
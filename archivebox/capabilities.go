@@ -0,0 +1,157 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// ErrNotSupported is returned for operations the archivebox version of the instance does not offer
+var ErrNotSupported = errors.New("not supported by this archivebox version")
+
+// Version of archivebox, zero if unknown
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// range of the archivebox versions the client is made for
+var (
+	MinSupportedVersion     = Version{0, 6, 0}
+	FirstUnsupportedVersion = Version{0, 9, 0}
+)
+
+// the rest api exists since v0.8
+var apiVersion = Version{0, 8, 0}
+
+// ParseVersion of the form 0.7.2 or v0.8.5rc51, pre-release suffixes are ignored
+func ParseVersion(s string) (Version, bool) {
+	match := versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return Version{}, false
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	v.Patch, _ = strconv.Atoi(match[3])
+	return v, true
+}
+
+func (v Version) String() string {
+	if v.IsZero() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Less is true if v is older than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// Capabilities of an instance, detected by Login. Unknown capabilities are assumed to be available.
+type Capabilities struct {
+	// zero if the instance does not show its version
+	Version Version
+	// the rest api exists, the client uses it with an api key only
+	HasAPI bool
+	// tags can be submitted and listed
+	HasTags bool
+	// archive methods offered by the add form, nil if unknown
+	ArchiveMethods []string
+	// names of the fields of the add form, nil if unknown
+	AddFormFields []string
+}
+
+// IsSupported is false for versions the client is not made for, unknown versions are treated as supported
+func (c Capabilities) IsSupported() bool {
+	return c.Version.IsZero() || (!c.Version.Less(MinSupportedVersion) && c.Version.Less(FirstUnsupportedVersion))
+}
+
+// HasAddFormField is true if the add form has the field or if its fields are unknown
+func (c Capabilities) HasAddFormField(name string) bool {
+	return c.AddFormFields == nil || slices.Contains(c.AddFormFields, name)
+}
+
+// the archive methods of the list the add form offers
+func (c Capabilities) supportedArchiveMethods(methods []string) []string {
+	if c.ArchiveMethods == nil {
+		return methods
+	}
+	var supported []string
+	for _, method := range methods {
+		if slices.Contains(c.ArchiveMethods, method) {
+			supported = append(supported, method)
+		}
+	}
+	return supported
+}
+
+// Capabilities of the instance detected by the last login
+func (c *Client) Capabilities() Capabilities {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.capabilities
+}
+
+// the version is shown in the footer of the pages, the add form reveals its fields.
+// Failures leave the capabilities unknown. Must be called with locked mutex after the login.
+func (c *Client) detectCapabilities(ctx context.Context) Capabilities {
+	capabilities := Capabilities{HasAPI: c.usesAPI}
+	pagePath := addPath
+	if c.usesAPI {
+		// without admin session the add form is not accessible
+		pagePath = loginPath
+	}
+	if content, err := c.fetchPage(ctx, pagePath); err == nil {
+		capabilities.Version = parseVersionOfPage(content)
+		// other pages than the add form leave the fields unknown, e.g. an error page of a proxy
+		if fields := parseFormFields(content); pagePath == addPath && slices.Contains(fields, "url") {
+			capabilities.AddFormFields = fields
+			capabilities.ArchiveMethods = parseArchiveMethods(content)
+		}
+	}
+	isVersionKnown := !capabilities.Version.IsZero()
+	if isVersionKnown && !capabilities.Version.Less(apiVersion) {
+		capabilities.HasAPI = true
+	}
+	switch {
+	case c.usesAPI:
+		capabilities.HasTags = true
+	case capabilities.AddFormFields != nil:
+		capabilities.HasTags = capabilities.HasAddFormField("tag")
+	default:
+		// tags exist since v0.6
+		capabilities.HasTags = !isVersionKnown || !capabilities.Version.Less(MinSupportedVersion)
+	}
+	return capabilities
+}
@@ -0,0 +1,106 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseVersionOfPage(t *testing.T) {
+	pages := map[string]Version{
+		`Archive created using <a href="https://github.com/ArchiveBox/ArchiveBox" title="Github">ArchiveBox</a> version ` +
+			`<a href="https://github.com/ArchiveBox/ArchiveBox/releases/tag/v0.7.2" title="Releases">v0.7.2</a>`: {0, 7, 2},
+		`<a href="/">ArchiveBox</a> <small>v0.8.5rc51</small>`: {0, 8, 5},
+		`<title>ArchiveBox 0.6.2</title>`:                      {0, 6, 2},
+		`<h1>Log in</h1>`:                                      {},
+	}
+	for page, expected := range pages {
+		if version := parseVersionOfPage([]byte(page)); version != expected {
+			t.Errorf("Expected version %v of %q, got %v", expected, page, version)
+		}
+	}
+	if !(Capabilities{Version: Version{0, 7, 2}}).IsSupported() || (Capabilities{Version: Version{0, 5, 6}}).IsSupported() ||
+		(Capabilities{Version: Version{0, 9, 0}}).IsSupported() || !(Capabilities{}).IsSupported() {
+		t.Errorf("Unexpected supported versions")
+	}
+}
+
+func TestParseAddForm(t *testing.T) {
+	form := []byte(`<form method="POST"><input type="hidden" name="csrfmiddlewaretoken" value="x">` +
+		`<textarea name="url"></textarea><select name="parser"></select><input type="text" name="tag">` +
+		`<input type="checkbox" name="archive_methods" value="title" id="id_archive_methods_0">` +
+		`<input type="checkbox" value="wget" name="archive_methods"></form>`)
+	if fields := parseFormFields(form); !reflect.DeepEqual(fields, []string{"url", "parser", "tag", "archive_methods"}) {
+		t.Errorf("Unexpected form fields %v", fields)
+	}
+	if methods := parseArchiveMethods(form); !reflect.DeepEqual(methods, []string{"title", "wget"}) {
+		t.Errorf("Unexpected archive methods %v", methods)
+	}
+}
+
+func TestClientWithOldAddForm(t *testing.T) {
+	var submitted url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := r.Cookie("sessionid")
+		switch {
+		case r.URL.Path == loginPath && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "csrf", Path: "/"})
+			_, _ = w.Write([]byte(`<input type="hidden" name="csrfmiddlewaretoken" value="middleware">`))
+		case r.URL.Path == loginPath:
+			http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "session", Path: "/"})
+			w.Header().Set("Location", "/")
+			w.WriteHeader(http.StatusFound)
+		case session == nil:
+			w.Header().Set("Location", loginPath)
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == addPath && r.Method == http.MethodGet:
+			// the add form of v0.5 without tags and archive methods
+			_, _ = w.Write([]byte(`<form><textarea name="url"></textarea><input type="radio" name="depth" value="0"></form>` +
+				`<footer>ArchiveBox version <a href="https://github.com/ArchiveBox/ArchiveBox/releases/tag/v0.5.6">v0.5.6</a></footer>`))
+		case r.URL.Path == addPath:
+			_ = r.ParseForm()
+			submitted = r.PostForm
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	client, _ := NewClient(Config{InstanceURL: server.URL, Username: "admin", Password: "secret"})
+	if err := client.Login(ctx); err != nil {
+		t.Fatal(err)
+	}
+	capabilities := client.Capabilities()
+	if capabilities.Version != (Version{0, 5, 6}) || capabilities.IsSupported() || capabilities.HasAPI || capabilities.HasTags {
+		t.Errorf("Unexpected capabilities %+v", capabilities)
+	}
+	err := client.Add(ctx, AddOptions{URLs: []string{"https://example.org/"}, Tags: []string{"news"}, ArchiveMethods: []string{"wget"}})
+	if err != nil || submitted.Get("url") != "https://example.org/" || submitted.Has("tag") || submitted.Has("parser") ||
+		submitted.Has("archive_methods") || submitted.Get("depth") != "0" {
+		t.Errorf("Expected only the fields of the old form, got %v, %v", submitted, err)
+	}
+	if _, err = client.Tags(ctx); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected no tags, got %v", err)
+	}
+}
@@ -0,0 +1,735 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package archivebox is a client for ArchiveBox instances. It uses the rest api of ArchiveBox v0.8+ if an api key is
+// configured and falls back to the admin login form and the add form of older versions.
+package archivebox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	loginPath        = "/admin/login/"
+	logoutPath       = "/admin/logout/"
+	addPath          = "/add/"
+	snapshotListPath = "/admin/core/snapshot/"
+	tagListPath      = "/admin/core/tag/"
+
+	// upper limit of admin list pages fetched to collect the known tags
+	maxTagListPages = 50
+)
+
+// DefaultAcceptTimeout is a reasonable Config.AcceptTimeout, enough time for ArchiveBox to take over the submission
+const DefaultAcceptTimeout = 2 * time.Second
+
+// ErrNotLoggedIn is returned by methods requiring a successful Login before
+var ErrNotLoggedIn = errors.New("not logged in to archivebox")
+
+// ErrSessionExpired is returned if archivebox redirects to the login page, the client has to be logged in again
+var ErrSessionExpired = errors.New("archivebox session expired")
+
+// Config of a Client
+type Config struct {
+	// base url of the instance, e.g. http://127.0.0.1:8000
+	InstanceURL string
+	Username    string
+	Password    string
+	// key of the rest api (ArchiveBox v0.8+), the admin login form is used if empty or if there is no api
+	APIKey string
+	// ArchiveBox answers add requests after archiving has finished, which can take minutes. If > 0, an add request
+	// is treated as accepted if there is no response within this duration after the request was sent.
+	AcceptTimeout time.Duration
+	// optional transport of all requests, http.DefaultTransport is used if nil
+	Transport http.RoundTripper
+	// credentials of an authenticating reverse proxy in front of archivebox
+	ProxyAuth ProxyAuth
+}
+
+// Client of a single ArchiveBox instance, safe for concurrent use
+type Client struct {
+	config     Config
+	baseURL    *url.URL
+	httpClient *http.Client
+
+	mutex               sync.Mutex
+	csrfMiddlewareToken string
+	isLoggedIn          bool
+	usesAPI             bool
+	// submissions to the public add form without login
+	isAnonymous  bool
+	capabilities Capabilities
+}
+
+// AddOptions of a submission of urls
+type AddOptions struct {
+	URLs  []string
+	Tags  []string
+	Depth int
+	// archive methods (extractors) to use, all methods enabled on the server are used if empty
+	ArchiveMethods []string
+	// parser of the submitted urls, DefaultParser if empty
+	Parser string
+}
+
+// Snapshot of an archived url
+type Snapshot struct {
+	ID string
+	// unix timestamp with fraction, identifies the snapshot in the archive
+	Timestamp string
+	// empty if the url is not shown in the result row of the admin search
+	URL string
+}
+
+// Time of the snapshot, zero if the timestamp cannot be parsed
+func (s Snapshot) Time() time.Time {
+	seconds, err := strconv.ParseFloat(s.Timestamp, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(seconds), 0)
+}
+
+// NewClient validates the config and creates a client, Login has to be called before other requests
+func NewClient(config Config) (*Client, error) {
+	if len(strings.TrimSpace(config.InstanceURL)) == 0 {
+		return nil, errors.New("invalid empty url to archivebox")
+	}
+	instanceURL, err := NormalizeURL(config.InstanceURL)
+	if err != nil {
+		return nil, err
+	}
+	// the trailing slash keeps the path prefix of the instance when paths are resolved
+	baseURL, err := url.Parse(instanceURL + "/")
+	if err != nil {
+		return nil, err
+	}
+	config.InstanceURL = instanceURL
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+	if config.ProxyAuth.Mode == ProxyAuthRemoteUser && len(config.ProxyAuth.RemoteUser) == 0 {
+		config.ProxyAuth.RemoteUser = config.Username
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{config: config, baseURL: baseURL}
+	client.httpClient = &http.Client{
+		Transport: config.Transport,
+		Jar:       jar,
+		// redirects are meaningful for archivebox, e.g. after a successful login
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return client, nil
+}
+
+// InstanceURL of the client without trailing slash
+func (c *Client) InstanceURL() string {
+	return c.config.InstanceURL
+}
+
+// IsLoggedIn is true after a successful Login
+func (c *Client) IsLoggedIn() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.isLoggedIn
+}
+
+// UsesAPI is true if the client talks to the rest api instead of the admin forms
+func (c *Client) UsesAPI() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.usesAPI
+}
+
+// IsAnonymous is true if the client submits to the public add form without login, the admin lists are not available
+func (c *Client) IsAnonymous() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.isAnonymous
+}
+
+// drops the cookies of the instance, must be called with locked mutex
+func (c *Client) resetSession() {
+	cookies := c.httpClient.Jar.Cookies(c.baseURL)
+	for _, cookie := range cookies {
+		cookie.MaxAge = -1
+	}
+	c.httpClient.Jar.SetCookies(c.baseURL, cookies)
+	c.csrfMiddlewareToken = ""
+	c.isLoggedIn = false
+	c.usesAPI = false
+	c.isAnonymous = false
+}
+
+// Ping checks that the instance answers http requests, without login and regardless of redirects or authorization
+func (c *Client) Ping(ctx context.Context) error {
+	request, err := c.newRequest(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		// e.g. a reverse proxy without a running archivebox behind it
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Login authenticates with the api key or with username and password by the admin login form.
+// Without any credentials the public add form is used if the instance allows it, see IsAnonymous.
+func (c *Client) Login(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.login(ctx); err != nil {
+		return err
+	}
+	c.capabilities = c.detectCapabilities(ctx)
+	return nil
+}
+
+// must be called with locked mutex
+func (c *Client) login(ctx context.Context) error {
+	c.resetSession()
+
+	if len(c.config.APIKey) > 0 {
+		isAPIAvailable, err := c.checkAPIKey(ctx)
+		if err != nil {
+			return err
+		}
+		if isAPIAvailable {
+			c.usesAPI = true
+			c.isLoggedIn = true
+			return nil
+		}
+	}
+	if c.config.ProxyAuth.Mode == ProxyAuthRemoteUser {
+		return c.loginWithRemoteUser(ctx)
+	}
+	if len(c.config.APIKey) == 0 && len(c.config.Username) == 0 && len(c.config.Password) == 0 {
+		return c.loginAnonymously(ctx)
+	}
+	return c.loginWithForm(ctx)
+}
+
+// ResumeSession reuses the cookies of an earlier admin login, see SessionCookies. The session is validated by the
+// login page, which redirects logged in users. ErrSessionExpired is returned if the session is not valid anymore.
+func (c *Client) ResumeSession(ctx context.Context, cookies []*http.Cookie) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.resetSession()
+	var sessionCookies []*http.Cookie
+	for _, cookie := range cookies {
+		sessionCookies = append(sessionCookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: "/"})
+	}
+	c.httpClient.Jar.SetCookies(c.baseURL, sessionCookies)
+
+	request, err := c.newRequest(ctx, http.MethodGet, loginPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(request)
+	if err != nil {
+		c.resetSession()
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusFound && !isLoginRedirect(resp) && len(c.csrfToken()) > 0 {
+		c.isLoggedIn = true
+		c.capabilities = c.detectCapabilities(ctx)
+		return nil
+	}
+	c.resetSession()
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusFound {
+		// the login form is shown for invalid sessions
+		return ErrSessionExpired
+	}
+	return &StatusError{StatusCode: resp.StatusCode}
+}
+
+// SessionCookies of the admin login to resume the session with a later client, nil if the rest api or the public
+// add form is used
+func (c *Client) SessionCookies() []*http.Cookie {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.isLoggedIn || c.usesAPI || c.isAnonymous {
+		return nil
+	}
+	return c.httpClient.Jar.Cookies(c.baseURL)
+}
+
+func (c *Client) loginWithForm(ctx context.Context) error {
+	content, err := c.fetchPage(ctx, loginPath)
+	if err != nil {
+		return err
+	}
+	c.csrfMiddlewareToken = parseCSRFMiddlewareToken(content)
+	if len(c.csrfMiddlewareToken) == 0 {
+		return errors.New("cannot find csrfmiddlewaretoken")
+	}
+	if len(c.csrfToken()) == 0 {
+		return errors.New("cannot find csrftoken cookie")
+	}
+
+	formData := url.Values{}
+	formData.Set("csrfmiddlewaretoken", c.csrfMiddlewareToken)
+	formData.Set("username", c.config.Username)
+	formData.Set("password", c.config.Password)
+	formData.Set("next", "/")
+	resp, err := c.postForm(ctx, loginPath+"?next=/", formData)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		// the login form is shown again for invalid credentials
+		return &AuthenticationError{}
+	}
+	if resp.StatusCode != http.StatusFound {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	if len(c.cookie("sessionid")) == 0 {
+		return &AuthenticationError{}
+	}
+	c.isLoggedIn = true
+	return nil
+}
+
+// Logout ends the session of the admin login, the client can be logged in again afterwards
+func (c *Client) Logout(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.isLoggedIn || c.usesAPI || c.isAnonymous || c.config.ProxyAuth.Mode == ProxyAuthRemoteUser {
+		// the proxy would log in the user again with the next request
+		c.resetSession()
+		return nil
+	}
+	formData := url.Values{}
+	formData.Set("csrfmiddlewaretoken", c.csrfToken())
+	resp, err := c.postForm(ctx, logoutPath, formData)
+	c.resetSession()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Add submits urls to archivebox, see Config.AcceptTimeout for the point in time the method returns
+func (c *Client) Add(ctx context.Context, options AddOptions) error {
+	if len(options.URLs) == 0 {
+		return errors.New("no urls to add")
+	}
+	if len(options.Parser) == 0 {
+		options.Parser = DefaultParser
+	}
+
+	c.mutex.Lock()
+	isLoggedIn, usesAPI := c.isLoggedIn, c.usesAPI
+	c.mutex.Unlock()
+	if !isLoggedIn {
+		return ErrNotLoggedIn
+	}
+
+	// the request context is canceled once the submission is treated as accepted
+	requestCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var timerMutex sync.Mutex
+	var acceptTimer *time.Timer
+	isAccepted := false
+	if c.config.AcceptTimeout > 0 {
+		requestCtx = httptrace.WithClientTrace(requestCtx, &httptrace.ClientTrace{
+			WroteRequest: func(info httptrace.WroteRequestInfo) {
+				if info.Err != nil {
+					return
+				}
+				timerMutex.Lock()
+				defer timerMutex.Unlock()
+				if acceptTimer != nil {
+					// the request is replayed after a new login
+					acceptTimer.Stop()
+				}
+				acceptTimer = time.AfterFunc(c.config.AcceptTimeout, func() {
+					timerMutex.Lock()
+					isAccepted = true
+					timerMutex.Unlock()
+					cancel()
+				})
+			},
+		})
+		defer func() {
+			timerMutex.Lock()
+			defer timerMutex.Unlock()
+			if acceptTimer != nil {
+				acceptTimer.Stop()
+			}
+		}()
+	}
+
+	var resp *http.Response
+	var err error
+	if usesAPI {
+		resp, err = c.postJSON(requestCtx, apiAddPath, newAPIAddRequest(options))
+	} else {
+		resp, err = c.doWithLogin(requestCtx, func() (*http.Request, error) {
+			formData := url.Values{}
+			// the token changes with a new login
+			formData.Set("csrfmiddlewaretoken", c.addFormToken())
+			// the add form accepts one url per line
+			formData.Set("url", strings.Join(options.URLs, "\n"))
+			// older versions of the form lack some of the fields
+			capabilities := c.Capabilities()
+			if capabilities.HasAddFormField("parser") {
+				formData.Set("parser", options.Parser)
+			}
+			if capabilities.HasAddFormField("tag") {
+				formData.Set("tag", strings.Join(options.Tags, ","))
+			}
+			if capabilities.HasAddFormField("depth") {
+				formData.Set("depth", strconv.Itoa(options.Depth))
+			}
+			if capabilities.HasAddFormField("archive_methods") {
+				for _, method := range capabilities.supportedArchiveMethods(options.ArchiveMethods) {
+					formData.Add("archive_methods", method)
+				}
+			}
+			return c.newFormRequest(requestCtx, addPath, formData)
+		})
+	}
+	if err != nil {
+		timerMutex.Lock()
+		defer timerMutex.Unlock()
+		if isAccepted && ctx.Err() == nil {
+			// archivebox took over the submission and is busy with archiving
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Search snapshots by an arbitrary query like a part of the url or the title
+func (c *Client) Search(ctx context.Context, query string) ([]Snapshot, error) {
+	if !c.IsLoggedIn() || c.IsAnonymous() {
+		return nil, ErrNotLoggedIn
+	}
+	if c.UsesAPI() {
+		return c.searchWithAPI(ctx, "search", query)
+	}
+	content, err := c.getPage(ctx, snapshotListPath+"?q="+url.QueryEscape(query))
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshots(content), nil
+}
+
+// FindSnapshots of exactly the url, the newest first
+func (c *Client) FindSnapshots(ctx context.Context, snapshotURL string) ([]Snapshot, error) {
+	var snapshots []Snapshot
+	var err error
+	if c.UsesAPI() {
+		snapshots, err = c.searchWithAPI(ctx, "url", snapshotURL)
+	} else {
+		// the admin search matches parts of the url and the title
+		snapshots, err = c.Search(ctx, snapshotURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var found []Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.URL == snapshotURL {
+			found = append(found, snapshot)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Time().After(found[j].Time())
+	})
+	return found, nil
+}
+
+// FindSnapshot of the url, the newest one if there are several, nil if the url is not archived
+func (c *Client) FindSnapshot(ctx context.Context, snapshotURL string) (*Snapshot, error) {
+	snapshots, err := c.FindSnapshots(ctx, snapshotURL)
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return &snapshots[0], nil
+}
+
+// Tags returns the sorted names of all tags of the instance
+func (c *Client) Tags(ctx context.Context) ([]string, error) {
+	if !c.IsLoggedIn() || c.IsAnonymous() {
+		return nil, ErrNotLoggedIn
+	}
+	if !c.Capabilities().HasTags {
+		return nil, ErrNotSupported
+	}
+	if c.UsesAPI() {
+		tags, err := c.tagsWithAPI(ctx)
+		sort.Strings(tags)
+		return tags, err
+	}
+
+	seenTags := map[string]bool{}
+	var tags []string
+	// the first page is requested without page parameter, further pages are discovered by the paginator links
+	pending := []string{""}
+	visitedPages := map[string]bool{"": true}
+	for len(pending) > 0 && len(visitedPages) <= maxTagListPages {
+		page := pending[0]
+		pending = pending[1:]
+
+		pagePath := tagListPath
+		if len(page) > 0 {
+			pagePath += "?p=" + page
+		}
+		content, err := c.getPage(ctx, pagePath)
+		if err != nil {
+			return tags, err
+		}
+		for _, name := range parseTagNames(content) {
+			if !seenTags[name] {
+				seenTags[name] = true
+				tags = append(tags, name)
+			}
+		}
+		for _, nextPage := range parseTagListPages(content) {
+			if !visitedPages[nextPage] {
+				visitedPages[nextPage] = true
+				pending = append(pending, nextPage)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, apiPath string, body io.Reader) (*http.Request, error) {
+	requestURL, err := c.resolve(apiPath)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Cache-Control", "max-age=0, no-cache, no-store, must-revalidate, private")
+	if len(c.config.APIKey) > 0 {
+		request.Header.Set(apiKeyHeader, c.config.APIKey)
+	}
+	c.config.ProxyAuth.apply(request)
+	return request, nil
+}
+
+func (c *Client) do(request *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		if request.Context().Err() != nil {
+			return nil, request.Context().Err()
+		}
+		return nil, &ConnectionError{InstanceURL: c.config.InstanceURL, Err: err}
+	}
+	return resp, nil
+}
+
+// sends the request of an admin login session. If the session expired or django rejected the csrf token, the client
+// logs in again and replays the request once, buildRequest is called again to use the new csrf token.
+func (c *Client) doWithLogin(ctx context.Context, buildRequest func() (*http.Request, error)) (*http.Response, error) {
+	request, err := buildRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(request)
+	if err != nil || c.UsesAPI() || !isSessionFailure(resp) {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	if err = c.relogin(ctx); err != nil {
+		return nil, err
+	}
+	if request, err = buildRequest(); err != nil {
+		return nil, err
+	}
+	resp, err = c.do(request)
+	if err != nil {
+		return nil, err
+	}
+	if isSessionFailure(resp) {
+		resp.Body.Close()
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.resetSession()
+		return nil, ErrSessionExpired
+	}
+	return resp, nil
+}
+
+// new admin login with a fresh csrf token, ErrSessionExpired if there are no credentials for a resumed session
+func (c *Client) relogin(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	isAnonymous := c.isAnonymous
+	c.resetSession()
+	if isAnonymous {
+		return c.loginAnonymously(ctx)
+	}
+	if c.config.ProxyAuth.Mode == ProxyAuthRemoteUser {
+		return c.loginWithRemoteUser(ctx)
+	}
+	if len(c.config.Username) == 0 || len(c.config.Password) == 0 {
+		return ErrSessionExpired
+	}
+	return c.loginWithForm(ctx)
+}
+
+// fetch the content of an admin page with the session of the client, fails for other status codes than 200
+func (c *Client) getPage(ctx context.Context, pagePath string) ([]byte, error) {
+	resp, err := c.doWithLogin(ctx, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodGet, pagePath, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return readPage(resp)
+}
+
+// fetch the content of a page without login, e.g. the login page itself
+func (c *Client) fetchPage(ctx context.Context, pagePath string) ([]byte, error) {
+	request, err := c.newRequest(ctx, http.MethodGet, pagePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+	return readPage(resp)
+}
+
+func readPage(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// the session expired or the csrf token is not valid anymore, e.g. after a restart of archivebox with a new secret key
+func isSessionFailure(resp *http.Response) bool {
+	return isLoginRedirect(resp) || isCSRFFailure(resp)
+}
+
+// django redirects requests of the admin and the add form without valid session to the login page
+func isLoginRedirect(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusFound && resp.StatusCode != http.StatusSeeOther {
+		return false
+	}
+	location, err := resp.Location()
+	// the login page may be below the path prefix of the instance
+	return err == nil && strings.Contains(location.Path, loginPath)
+}
+
+// django answers with 403 and a page mentioning csrf, the body stays readable for the caller
+func isCSRFFailure(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+	return err == nil && bytes.Contains(bytes.ToUpper(content), []byte("CSRF"))
+}
+
+func (c *Client) newFormRequest(ctx context.Context, formPath string, formData url.Values) (*http.Request, error) {
+	request, err := c.newRequest(ctx, http.MethodPost, formPath, bytes.NewBufferString(formData.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// django checks origin and referer for csrf protection
+	request.Header.Set("Origin", c.origin())
+	request.Header.Set("Referer", request.URL.String())
+	return request, nil
+}
+
+func (c *Client) postForm(ctx context.Context, formPath string, formData url.Values) (*http.Response, error) {
+	request, err := c.newFormRequest(ctx, formPath, formData)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(request)
+}
+
+func (c *Client) origin() string {
+	return fmt.Sprintf("%s://%s", c.baseURL.Scheme, c.baseURL.Host)
+}
+
+func (c *Client) cookie(name string) string {
+	for _, cookie := range c.httpClient.Jar.Cookies(c.baseURL) {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// the csrf token of the cookie is accepted by django as form token, it changes after the login
+func (c *Client) csrfToken() string {
+	return c.cookie("csrftoken")
+}
+
+// the token of the public add form is posted without login, like a browser does, the cookie token otherwise
+func (c *Client) addFormToken() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.isAnonymous {
+		return c.csrfMiddlewareToken
+	}
+	return c.csrfToken()
+}
@@ -0,0 +1,252 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// minimal imitation of the admin login, the add form and the admin lists of archivebox
+func newAdminTestServer(t *testing.T, added *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := r.Cookie("sessionid")
+		isLoggedIn := session != nil && session.Value == "session"
+		switch {
+		case r.URL.Path == "/":
+			w.Header().Set("Location", "/public/")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == loginPath && r.Method == http.MethodGet && isLoggedIn:
+			w.Header().Set("Location", "/admin/")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == loginPath && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "csrf", Path: "/"})
+			_, _ = w.Write([]byte(`<input type="hidden" name="csrfmiddlewaretoken" value="middleware">`))
+		case r.URL.Path == loginPath:
+			if r.FormValue("csrfmiddlewaretoken") != "middleware" || r.FormValue("password") != "secret" {
+				_, _ = w.Write([]byte(`<form>invalid login</form>`))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "session", Path: "/"})
+			w.Header().Set("Location", "/")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == logoutPath && isLoggedIn:
+			http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "", Path: "/", MaxAge: -1})
+			w.Header().Set("Location", "/")
+			w.WriteHeader(http.StatusFound)
+		case !isLoggedIn:
+			w.Header().Set("Location", loginPath)
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == addPath:
+			if r.FormValue("csrfmiddlewaretoken") != "csrf" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`<h1>Forbidden (403)</h1><p>CSRF verification failed. Request aborted.</p>`))
+				return
+			}
+			*added = append(*added, r.FormValue("url"), r.FormValue("tag"), r.FormValue("parser"))
+		case r.URL.Path == tagListPath && r.URL.Query().Get("p") == "":
+			_, _ = w.Write([]byte(`<td class="field-name">news</td><a href="?p=1">2</a>`))
+		case r.URL.Path == tagListPath:
+			_, _ = w.Write([]byte(`<td class="field-name">golang</td><a href="?p=1">2</a>`))
+		case r.URL.Path == snapshotListPath && (r.URL.Query().Get("q") == "https://example.org/" ||
+			r.URL.Query().Get("q") == "https://example.org/missing"):
+			// the admin search matches parts of the url, the result is the snapshot of https://example.org/ for both
+			_, _ = w.Write([]byte(`<input type="checkbox" name="_selected_action" value="01J0">` +
+				`<a href="/archive/1700000000.1/index.html">Example</a>` +
+				`<td class="field-url_str"><a href="https://example.org/"><code>https://example.org/</code></a></td>`))
+		case r.URL.Path == snapshotListPath:
+			_, _ = w.Write([]byte(`0 results`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestClientWithAdminLogin(t *testing.T) {
+	var added []string
+	server := newAdminTestServer(t, &added)
+	defer server.Close()
+	ctx := context.Background()
+
+	client, err := NewClient(Config{InstanceURL: server.URL + "/", Username: "admin", Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Ping(ctx); err != nil {
+		t.Errorf("Expected instance to be reachable, got %v", err)
+	}
+	var authErr *AuthenticationError
+	if err = client.Login(ctx); !errors.As(err, &authErr) {
+		t.Errorf("Expected authentication error, got %v", err)
+	}
+	if err = client.Add(ctx, AddOptions{URLs: []string{"https://example.org/"}}); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Expected not logged in error, got %v", err)
+	}
+
+	client, _ = NewClient(Config{InstanceURL: server.URL, Username: "admin", Password: "secret"})
+	if err = client.Login(ctx); err != nil || !client.IsLoggedIn() || client.UsesAPI() {
+		t.Fatalf("Expected login with the admin form, got %v", err)
+	}
+	err = client.Add(ctx, AddOptions{URLs: []string{"https://example.org/", "https://example.org/b"}, Tags: []string{"a", "b"}})
+	expected := []string{"https://example.org/\nhttps://example.org/b", "a,b", DefaultParser}
+	if err != nil || !reflect.DeepEqual(added, expected) {
+		t.Errorf("Expected submission %q, got %q, %v", expected, added, err)
+	}
+
+	tags, err := client.Tags(ctx)
+	if err != nil || !reflect.DeepEqual(tags, []string{"golang", "news"}) {
+		t.Errorf("Unexpected tags %v, %v", tags, err)
+	}
+	snapshot, err := client.FindSnapshot(ctx, "https://example.org/")
+	if err != nil || snapshot == nil || snapshot.ID != "01J0" {
+		t.Errorf("Expected snapshot, got %v, %v", snapshot, err)
+	}
+	snapshot, err = client.FindSnapshot(ctx, "https://example.org/missing")
+	if err != nil || snapshot != nil {
+		t.Errorf("Expected no snapshot, got %v, %v", snapshot, err)
+	}
+}
+
+func TestClientResumeSession(t *testing.T) {
+	var added []string
+	server := newAdminTestServer(t, &added)
+	defer server.Close()
+	ctx := context.Background()
+
+	client, _ := NewClient(Config{InstanceURL: server.URL, Username: "admin", Password: "secret"})
+	if err := client.Login(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cookies := client.SessionCookies()
+	if len(cookies) != 2 {
+		t.Fatalf("Expected session and csrf cookie, got %v", cookies)
+	}
+
+	resumed, _ := NewClient(Config{InstanceURL: server.URL, Username: "admin", Password: "secret"})
+	if err := resumed.ResumeSession(ctx, cookies); err != nil || !resumed.IsLoggedIn() {
+		t.Fatalf("Expected resumed session, got %v", err)
+	}
+	if err := resumed.Add(ctx, AddOptions{URLs: []string{"https://example.org/"}}); err != nil || len(added) == 0 {
+		t.Errorf("Expected submission with the resumed session, got %v", err)
+	}
+
+	expired := []*http.Cookie{{Name: "sessionid", Value: "expired"}, {Name: "csrftoken", Value: "csrf"}}
+	if err := resumed.ResumeSession(ctx, expired); !errors.Is(err, ErrSessionExpired) || resumed.IsLoggedIn() {
+		t.Errorf("Expected expired session, got %v", err)
+	}
+
+	// the session expires while the client is in use, a client without credentials cannot log in again
+	resumed, _ = NewClient(Config{InstanceURL: server.URL})
+	if err := resumed.ResumeSession(ctx, cookies); err != nil {
+		t.Fatal(err)
+	}
+	instanceURL, _ := url.Parse(server.URL + "/")
+	resumed.httpClient.Jar.SetCookies(instanceURL, []*http.Cookie{{Name: "sessionid", Value: "expired", Path: "/"}})
+	if err := resumed.Add(ctx, AddOptions{URLs: []string{"https://example.org/"}}); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Expected expired session, got %v", err)
+	}
+	if resumed.IsLoggedIn() {
+		t.Errorf("Expected client to be logged out after the session expired")
+	}
+}
+
+func TestClientLogsInAgain(t *testing.T) {
+	var added []string
+	server := newAdminTestServer(t, &added)
+	defer server.Close()
+	ctx := context.Background()
+	instanceURL, _ := url.Parse(server.URL + "/")
+
+	client, _ := NewClient(Config{InstanceURL: server.URL, Username: "admin", Password: "secret"})
+	if err := client.Login(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// expired session
+	client.httpClient.Jar.SetCookies(instanceURL, []*http.Cookie{{Name: "sessionid", Value: "expired", Path: "/"}})
+	tags, err := client.Tags(ctx)
+	if err != nil || len(tags) != 2 {
+		t.Errorf("Expected tags after a new login, got %v, %v", tags, err)
+	}
+	// rejected csrf token
+	client.httpClient.Jar.SetCookies(instanceURL, []*http.Cookie{{Name: "csrftoken", Value: "stale", Path: "/"}})
+	if err = client.Add(ctx, AddOptions{URLs: []string{"https://example.org/"}}); err != nil || len(added) != 3 {
+		t.Errorf("Expected submission after a new login, got %v, %q", err, added)
+	}
+	if !client.IsLoggedIn() {
+		t.Errorf("Expected client to be logged in")
+	}
+}
+
+func TestClientWithAPIKey(t *testing.T) {
+	var added apiAddRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(apiKeyHeader) != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case apiCheckTokenPath:
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			_ = json.NewEncoder(w).Encode(apiTokenCheckResponse{Success: body["token"] == "secret"})
+		case apiAddPath:
+			_ = json.NewDecoder(r.Body).Decode(&added)
+		case apiSnapshotsPath:
+			list := apiSnapshotList{}
+			if r.URL.Query().Get("url") == "https://example.org/" {
+				list.Items = append(list.Items, apiSnapshot{ID: "01J0", Timestamp: "1700000000.1", URL: "https://example.org/"})
+			}
+			_ = json.NewEncoder(w).Encode(list)
+		case apiTagsPath:
+			_ = json.NewEncoder(w).Encode([]apiTag{{Name: "news"}, {Name: " "}, {Name: "golang"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	client, _ := NewClient(Config{InstanceURL: server.URL, APIKey: "secret"})
+	if err := client.Login(ctx); err != nil || !client.UsesAPI() {
+		t.Fatalf("Expected login with the api key, got %v", err)
+	}
+	err := client.Add(ctx, AddOptions{URLs: []string{"https://example.org/"}, Depth: 1, ArchiveMethods: []string{"wget", "pdf"}})
+	if err != nil || added.Depth != 1 || added.Extractors != "wget,pdf" || added.Parser != DefaultParser {
+		t.Errorf("Unexpected submission %v, %v", added, err)
+	}
+	snapshot, err := client.FindSnapshot(ctx, "https://example.org/")
+	if err != nil || snapshot == nil || snapshot.ID != "01J0" {
+		t.Errorf("Expected snapshot, got %v, %v", snapshot, err)
+	}
+	tags, err := client.Tags(ctx)
+	if err != nil || !reflect.DeepEqual(tags, []string{"golang", "news"}) {
+		t.Errorf("Unexpected tags %v, %v", tags, err)
+	}
+
+	client, _ = NewClient(Config{InstanceURL: server.URL, APIKey: "wrong"})
+	var authErr *AuthenticationError
+	if err = client.Login(ctx); !errors.As(err, &authErr) {
+		t.Errorf("Expected authentication error, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// names of the steps of Diagnose in their order
+const (
+	StepParseURL   = "url"
+	StepDNS        = "dns"
+	StepTCP        = "tcp"
+	StepTLS        = "tls"
+	StepLoginPage  = "login-page"
+	StepCSRFCookie = "csrftoken"
+	StepCSRFToken  = "csrfmiddlewaretoken"
+	StepLogin      = "login"
+	StepSessionID  = "sessionid"
+)
+
+// DiagnosticStep result of a single step of the connection setup
+type DiagnosticStep struct {
+	Name     string
+	Duration time.Duration
+	// e.g. the resolved addresses or the negotiated tls version
+	Detail string
+	// nil if the step passed or was skipped
+	Err error
+	// the step is not applicable or an earlier step failed
+	Skipped bool
+}
+
+// Passed is true if the step ran without error
+func (s DiagnosticStep) Passed() bool {
+	return !s.Skipped && s.Err == nil
+}
+
+type diagnosis struct {
+	steps    []DiagnosticStep
+	isFailed bool
+}
+
+// runs the step unless an earlier step failed
+func (d *diagnosis) run(name string, step func() (string, error)) {
+	if d.isFailed {
+		d.steps = append(d.steps, DiagnosticStep{Name: name, Skipped: true})
+		return
+	}
+	start := time.Now()
+	detail, err := step()
+	d.steps = append(d.steps, DiagnosticStep{Name: name, Duration: time.Since(start), Detail: detail, Err: err})
+	d.isFailed = err != nil
+}
+
+func (d *diagnosis) skip(name string, detail string) {
+	if d.isFailed {
+		detail = ""
+	}
+	d.steps = append(d.steps, DiagnosticStep{Name: name, Detail: detail, Skipped: true})
+}
+
+// Diagnose runs the steps of the connection setup and the admin login one by one, the steps after a failed one are
+// skipped. A successful login is logged out again.
+func Diagnose(ctx context.Context, config Config) []DiagnosticStep {
+	d := &diagnosis{}
+	var client *Client
+	d.run(StepParseURL, func() (string, error) {
+		var err error
+		client, err = NewClient(config)
+		if err != nil {
+			return "", err
+		}
+		return client.InstanceURL(), nil
+	})
+	if client == nil {
+		for _, name := range []string{StepDNS, StepTCP, StepTLS, StepLoginPage, StepCSRFCookie, StepCSRFToken, StepLogin, StepSessionID} {
+			d.skip(name, "")
+		}
+		return d.steps
+	}
+
+	// a proxy is resolved and connected to instead of the instance, the tls handshake happens inside the tunnel
+	host, port := client.baseURL.Hostname(), portOf(client.baseURL)
+	var tlsConfig *tls.Config
+	proxyURL := ""
+	if transport, ok := client.config.Transport.(*http.Transport); ok {
+		tlsConfig = transport.TLSClientConfig.Clone()
+		if transport.Proxy != nil {
+			request := &http.Request{Method: http.MethodGet, URL: client.baseURL, Header: http.Header{}}
+			if proxy, err := transport.Proxy(request); err == nil && proxy != nil {
+				host, port = proxy.Hostname(), portOf(proxy)
+				proxyURL = proxy.Redacted()
+			}
+		}
+	}
+
+	d.run(StepDNS, func() (string, error) {
+		addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+		detail := strings.Join(addresses, ", ")
+		if len(proxyURL) > 0 {
+			detail += " (proxy " + proxyURL + ")"
+		}
+		return detail, err
+	})
+	var conn net.Conn
+	d.run(StepTCP, func() (string, error) {
+		var err error
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			return "", err
+		}
+		return conn.RemoteAddr().String(), nil
+	})
+	switch {
+	case client.baseURL.Scheme != "https":
+		d.skip(StepTLS, "no tls with http")
+	case len(proxyURL) > 0:
+		d.skip(StepTLS, "tls through the proxy, see "+StepLoginPage)
+	default:
+		d.run(StepTLS, func() (string, error) {
+			if tlsConfig == nil {
+				tlsConfig = &tls.Config{}
+			}
+			tlsConfig.ServerName = client.baseURL.Hostname()
+			tlsConn := tls.Client(conn, tlsConfig)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return "", err
+			}
+			state := tlsConn.ConnectionState()
+			detail := tls.VersionName(state.Version)
+			if len(state.PeerCertificates) > 0 {
+				certificate := state.PeerCertificates[0]
+				detail += fmt.Sprintf(", %s, valid until %s", certificate.Subject.CommonName, certificate.NotAfter.Format(time.DateOnly))
+			}
+			return detail, nil
+		})
+	}
+	if conn != nil {
+		conn.Close()
+	}
+
+	var loginPage []byte
+	d.run(StepLoginPage, func() (string, error) {
+		var err error
+		loginPage, err = client.fetchPage(ctx, loginPath)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d bytes", len(loginPage)), nil
+	})
+	d.run(StepCSRFCookie, func() (string, error) {
+		if len(client.csrfToken()) == 0 {
+			return "", errors.New("the login page sets no csrftoken cookie")
+		}
+		return "", nil
+	})
+	d.run(StepCSRFToken, func() (string, error) {
+		client.csrfMiddlewareToken = parseCSRFMiddlewareToken(loginPage)
+		if len(client.csrfMiddlewareToken) == 0 {
+			return "", errors.New("no csrfmiddlewaretoken in the login page")
+		}
+		return "", nil
+	})
+	if len(config.Username) == 0 || len(config.Password) == 0 {
+		d.skip(StepLogin, "no username and password")
+		d.skip(StepSessionID, "no username and password")
+		return d.steps
+	}
+	d.run(StepLogin, func() (string, error) {
+		formData := url.Values{}
+		formData.Set("csrfmiddlewaretoken", client.csrfMiddlewareToken)
+		formData.Set("username", config.Username)
+		formData.Set("password", config.Password)
+		formData.Set("next", "/")
+		resp, err := client.postForm(ctx, loginPath+"?next=/", formData)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			// the login form is shown again for invalid credentials
+			return "", &AuthenticationError{}
+		}
+		if resp.StatusCode != http.StatusFound {
+			return "", &StatusError{StatusCode: resp.StatusCode}
+		}
+		return resp.Header.Get("Location"), nil
+	})
+	d.run(StepSessionID, func() (string, error) {
+		if len(client.cookie("sessionid")) == 0 {
+			return "", errors.New("no sessionid cookie after the login")
+		}
+		client.mutex.Lock()
+		client.isLoggedIn = true
+		client.mutex.Unlock()
+		// the diagnosis leaves no session behind, a failed logout does not affect the result
+		_ = client.Logout(ctx)
+		return "", nil
+	})
+	return d.steps
+}
+
+// port of the url, the default port of the scheme if there is none
+func portOf(u *url.URL) string {
+	if port := u.Port(); len(port) > 0 {
+		return port
+	}
+	switch u.Scheme {
+	case "https":
+		return "443"
+	case "socks5", "socks5h":
+		return "1080"
+	default:
+		return "80"
+	}
+}
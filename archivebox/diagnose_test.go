@@ -0,0 +1,74 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// names of the passed, failed and skipped steps
+func diagnosisSummary(steps []DiagnosticStep) (passed []string, failed []string, skipped []string) {
+	for _, step := range steps {
+		switch {
+		case step.Skipped:
+			skipped = append(skipped, step.Name)
+		case step.Err != nil:
+			failed = append(failed, step.Name)
+		default:
+			passed = append(passed, step.Name)
+		}
+	}
+	return passed, failed, skipped
+}
+
+func TestDiagnose(t *testing.T) {
+	var added []string
+	server := newAdminTestServer(t, &added)
+	defer server.Close()
+	ctx := context.Background()
+
+	steps := Diagnose(ctx, Config{InstanceURL: server.URL, Username: "admin", Password: "secret"})
+	passed, failed, skipped := diagnosisSummary(steps)
+	if len(passed) != 8 || len(failed) != 0 || len(skipped) != 1 || skipped[0] != StepTLS {
+		t.Errorf("Expected all steps but tls to pass, got passed %v, failed %v, skipped %v", passed, failed, skipped)
+	}
+
+	steps = Diagnose(ctx, Config{InstanceURL: server.URL, Username: "admin", Password: "wrong"})
+	var authErr *AuthenticationError
+	if _, failed, _ = diagnosisSummary(steps); len(failed) != 1 || failed[0] != StepLogin || !errors.As(steps[7].Err, &authErr) {
+		t.Errorf("Expected failed login, got %v", failed)
+	}
+	if !steps[8].Skipped {
+		t.Errorf("Expected the steps after the failed login to be skipped")
+	}
+
+	offline := httptest.NewServer(http.NotFoundHandler())
+	offline.Close()
+	steps = Diagnose(ctx, Config{InstanceURL: offline.URL})
+	if passed, failed, skipped = diagnosisSummary(steps); len(passed) != 2 || len(failed) != 1 || failed[0] != StepTCP || len(skipped) != 6 {
+		t.Errorf("Expected failed tcp connection, got passed %v, failed %v, skipped %v", passed, failed, skipped)
+	}
+
+	steps = Diagnose(ctx, Config{InstanceURL: "archive.example.org"})
+	if _, failed, skipped = diagnosisSummary(steps); len(failed) != 1 || failed[0] != StepParseURL || len(skipped) != 8 {
+		t.Errorf("Expected invalid url, got failed %v, skipped %v", failed, skipped)
+	}
+}
@@ -0,0 +1,89 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ConnectionError archivebox could not be reached, e.g. because of dns or network problems
+type ConnectionError struct {
+	InstanceURL string
+	Err         error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("cannot reach archivebox: %v", e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError unexpected http status code of an archivebox response
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+// AuthenticationError archivebox rejected the username and password or the api key
+type AuthenticationError struct{}
+
+func (e *AuthenticationError) Error() string {
+	return "login failed, invalid credentials"
+}
+
+// IsConnectionError is true if archivebox could not be reached
+func IsConnectionError(err error) bool {
+	var connErr *ConnectionError
+	return errors.As(err, &connErr)
+}
+
+// IsRetryable is true for temporary problems like unreachable hosts or server errors and false for rejected requests
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrSessionExpired) {
+		// a new login is made by the next attempt
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var authErr *AuthenticationError
+	if errors.As(err, &authErr) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,62 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	retryable := []error{
+		&ConnectionError{Err: &net.DNSError{Err: "no such host", Name: "archivebox.lan"}},
+		&ConnectionError{Err: refused},
+		&StatusError{StatusCode: 502},
+		ErrSessionExpired,
+	}
+	for _, err := range retryable {
+		if !IsRetryable(err) {
+			t.Errorf("Expected '%v' to be retryable", err)
+		}
+	}
+	permanent := []error{
+		&StatusError{StatusCode: 403},
+		&AuthenticationError{},
+		fmt.Errorf("wrapped: %w", &AuthenticationError{}),
+		errors.New("invalid url"),
+		nil,
+	}
+	for _, err := range permanent {
+		if IsRetryable(err) {
+			t.Errorf("Expected '%v' not to be retryable", err)
+		}
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	if !IsConnectionError(fmt.Errorf("wrapped: %w", &ConnectionError{Err: errors.New("offline")})) {
+		t.Error("Expected wrapped connection error to be detected")
+	}
+	if IsConnectionError(errors.New("invalid url")) || IsConnectionError(nil) {
+		t.Error("Expected other errors not to be connection errors")
+	}
+}
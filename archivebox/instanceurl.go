@@ -0,0 +1,85 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrNotArchiveBox is returned by Probe if there is no archivebox admin at the url, e.g. a wrong path prefix
+var ErrNotArchiveBox = errors.New("no archivebox found at the url")
+
+// NormalizeURL of an instance: lower case scheme and host, without default port and trailing slashes.
+// Instances may be mounted under a path prefix, e.g. https://tools.example.com/archivebox
+func NormalizeURL(rawURL string) (string, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return "", errors.New("url does not start with 'http[s]://'")
+	}
+	if len(parsedURL.Hostname()) == 0 {
+		return "", errors.New("url without host")
+	}
+	if len(parsedURL.RawQuery) > 0 || len(parsedURL.Fragment) > 0 || parsedURL.User != nil {
+		return "", errors.New("url of archivebox must not contain credentials, query or fragment")
+	}
+	parsedURL.Host = strings.ToLower(parsedURL.Host)
+	if port := parsedURL.Port(); (parsedURL.Scheme == "http" && port == "80") || (parsedURL.Scheme == "https" && port == "443") {
+		parsedURL.Host = strings.TrimSuffix(parsedURL.Host, ":"+port)
+	}
+	parsedURL.Path = strings.TrimRight(parsedURL.Path, "/")
+	parsedURL.RawPath = strings.TrimRight(parsedURL.RawPath, "/")
+	return parsedURL.String(), nil
+}
+
+// url of a path of archivebox below the instance url, the path prefix of the instance is kept
+func (c *Client) resolve(instancePath string) (*url.URL, error) {
+	reference, err := url.Parse(strings.TrimPrefix(instancePath, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return c.baseURL.ResolveReference(reference), nil
+}
+
+// Probe checks that archivebox answers at the url, the login page has to exist below the instance url
+func (c *Client) Probe(ctx context.Context) error {
+	request, err := c.newRequest(ctx, http.MethodGet, loginPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusFound:
+		// the login form or the redirect of a user logged in by a proxy
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotArchiveBox
+	default:
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+}
@@ -0,0 +1,54 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+// DefaultParser lets archivebox detect the format of the submitted urls
+const DefaultParser = "auto"
+
+// ArchiveMethods are the archive methods (extractors) accepted by archivebox
+var ArchiveMethods = []string{
+	"title",
+	"favicon",
+	"headers",
+	"singlefile",
+	"pdf",
+	"screenshot",
+	"dom",
+	"wget",
+	"readability",
+	"mercury",
+	"git",
+	"media",
+	"archive_org",
+}
+
+// Parsers are the parsers archivebox uses to read the submitted urls
+var Parsers = []string{
+	DefaultParser,
+	"url_list",
+	"txt",
+	"html",
+	"json",
+	"jsonl",
+	"rss",
+	"netscape_html",
+	"pocket_html",
+	"pinboard_rss",
+	"shaarli_rss",
+	"medium_rss",
+	"wallabag",
+}
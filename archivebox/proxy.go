@@ -0,0 +1,78 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyOptions of the connections to an instance
+type ProxyOptions struct {
+	// http, https or socks5 url of the proxy, e.g. socks5://127.0.0.1:1080. If empty, the proxy of the environment
+	// (HTTP_PROXY, HTTPS_PROXY and NO_PROXY) is used unless Direct is set.
+	URL      string
+	Username string
+	Password string
+	// hosts, domains like .example.org, ip addresses and cidr ranges which are connected to directly
+	NoProxy []string
+	// ignores the proxy of the environment
+	Direct bool
+}
+
+// Apply sets the proxy of the transport, see NewTransport
+func (o ProxyOptions) Apply(transport *http.Transport) error {
+	if o.Direct {
+		transport.Proxy = nil
+		return nil
+	}
+	if len(strings.TrimSpace(o.URL)) == 0 {
+		transport.Proxy = http.ProxyFromEnvironment
+		return nil
+	}
+	proxyURL, err := url.Parse(strings.TrimSpace(o.URL))
+	if err != nil {
+		return err
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	case "socks5h":
+		// net/http resolves host names by the socks proxy anyway
+		proxyURL.Scheme = "socks5"
+	default:
+		return fmt.Errorf("unsupported proxy scheme '%s', expected http, https or socks5", proxyURL.Scheme)
+	}
+	if len(proxyURL.Host) == 0 {
+		return fmt.Errorf("proxy url '%s' without host", o.URL)
+	}
+	if len(o.Username) > 0 {
+		proxyURL.User = url.UserPassword(o.Username, o.Password)
+	}
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    strings.Join(o.NoProxy, ","),
+	}).ProxyFunc()
+	transport.Proxy = func(request *http.Request) (*url.URL, error) {
+		return proxyFunc(request.URL)
+	}
+	return nil
+}
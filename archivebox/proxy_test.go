@@ -0,0 +1,61 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyOptions(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a forward proxy receives the absolute url of the request
+		if r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+
+	ping := func(instanceURL string, options ProxyOptions) error {
+		transport, _ := NewTransport(TLSOptions{})
+		if err := options.Apply(transport); err != nil {
+			return err
+		}
+		client, _ := NewClient(Config{InstanceURL: instanceURL, Transport: transport})
+		return client.Ping(context.Background())
+	}
+	options := ProxyOptions{URL: proxy.URL, Username: "user", Password: "secret", NoProxy: []string{".lan"}}
+	if err := ping("http://archivebox.example.org", options); err != nil || len(proxied) != 1 ||
+		proxied[0] != "http://archivebox.example.org/" {
+		t.Errorf("Expected request by the proxy, got %v, %v", proxied, err)
+	}
+	if err := ping("http://archivebox.lan", options); !IsConnectionError(err) || len(proxied) != 1 {
+		t.Errorf("Expected direct connection to the host of the no proxy list, got %v", err)
+	}
+	if err := (ProxyOptions{URL: "ftp://proxy.lan"}).Apply(&http.Transport{}); err == nil {
+		t.Errorf("Expected unsupported scheme")
+	}
+	transport := &http.Transport{}
+	if err := (ProxyOptions{URL: "socks5h://127.0.0.1:1080"}).Apply(transport); err != nil || transport.Proxy == nil {
+		t.Errorf("Expected socks proxy, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ProxyAuthMode of an authenticating reverse proxy in front of archivebox
+type ProxyAuthMode string
+
+const (
+	ProxyAuthNone ProxyAuthMode = ""
+	// http basic auth checked by the proxy, the admin login is needed nevertheless
+	ProxyAuthBasic ProxyAuthMode = "basic"
+	// static bearer token checked by the proxy, the admin login is needed nevertheless
+	ProxyAuthBearer ProxyAuthMode = "bearer"
+	// the proxy passes the name of the user by a header, see REVERSE_PROXY_USER_HEADER of archivebox.
+	// The admin login is not needed.
+	ProxyAuthRemoteUser ProxyAuthMode = "remote-user"
+)
+
+// DefaultRemoteUserHeader is the default REVERSE_PROXY_USER_HEADER of archivebox
+const DefaultRemoteUserHeader = "Remote-User"
+
+// ProxyAuth credentials of an authenticating reverse proxy, they are sent with every request
+type ProxyAuth struct {
+	Mode ProxyAuthMode
+	// user and password of ProxyAuthBasic
+	Username string
+	Password string
+	// token of ProxyAuthBearer
+	Token string
+	// header name and user of ProxyAuthRemoteUser, DefaultRemoteUserHeader and Config.Username are used if empty
+	Header     string
+	RemoteUser string
+}
+
+func (a ProxyAuth) apply(request *http.Request) {
+	switch a.Mode {
+	case ProxyAuthBasic:
+		request.SetBasicAuth(a.Username, a.Password)
+	case ProxyAuthBearer:
+		request.Header.Set("Authorization", "Bearer "+a.Token)
+	case ProxyAuthRemoteUser:
+		header := a.Header
+		if len(header) == 0 {
+			header = DefaultRemoteUserHeader
+		}
+		request.Header.Set(header, a.RemoteUser)
+	}
+}
+
+// the user is authenticated by the header, only the csrf token of the add form is needed.
+// Must be called with locked mutex.
+func (c *Client) loginWithRemoteUser(ctx context.Context) error {
+	request, err := c.newRequest(ctx, http.MethodGet, loginPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// the login page redirects authenticated users to the admin
+	if resp.StatusCode == http.StatusOK || isLoginRedirect(resp) {
+		return &AuthenticationError{}
+	}
+	if resp.StatusCode != http.StatusFound {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	if len(c.csrfToken()) == 0 {
+		// the add form sets the csrf cookie
+		if _, err = c.fetchPage(ctx, addPath); err != nil {
+			return err
+		}
+	}
+	if len(c.csrfToken()) == 0 {
+		return errors.New("cannot find csrftoken cookie")
+	}
+	c.isLoggedIn = true
+	return nil
+}
@@ -0,0 +1,88 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestProxyAuthHeaders(t *testing.T) {
+	tests := []struct {
+		auth     ProxyAuth
+		header   string
+		expected string
+	}{
+		{ProxyAuth{}, "Authorization", ""},
+		{ProxyAuth{Mode: ProxyAuthBasic, Username: "user", Password: "secret"}, "Authorization", "Basic dXNlcjpzZWNyZXQ="},
+		{ProxyAuth{Mode: ProxyAuthBearer, Token: "token"}, "Authorization", "Bearer token"},
+		{ProxyAuth{Mode: ProxyAuthRemoteUser, RemoteUser: "admin"}, DefaultRemoteUserHeader, "admin"},
+		{ProxyAuth{Mode: ProxyAuthRemoteUser, Header: "X-Forwarded-User", RemoteUser: "admin"}, "X-Forwarded-User", "admin"},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, "https://archive.example.org/", nil)
+		test.auth.apply(request)
+		if value := request.Header.Get(test.header); value != test.expected {
+			t.Errorf("Expected %s header %q for %v, got %q", test.header, test.expected, test.auth.Mode, value)
+		}
+	}
+}
+
+func TestClientWithRemoteUser(t *testing.T) {
+	var added []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(DefaultRemoteUserHeader) != "admin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == loginPath && r.Method == http.MethodGet:
+			w.Header().Set("Location", "/admin/")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == addPath && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "csrf", Path: "/"})
+		case r.URL.Path == addPath && r.FormValue("csrfmiddlewaretoken") == "csrf":
+			added = append(added, r.FormValue("url"))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	client, _ := NewClient(Config{InstanceURL: server.URL, ProxyAuth: ProxyAuth{Mode: ProxyAuthRemoteUser, RemoteUser: "guest"}})
+	var statusErr *StatusError
+	if err := client.Login(ctx); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected rejection by the proxy, got %v", err)
+	}
+
+	client, _ = NewClient(Config{InstanceURL: server.URL, Username: "admin", ProxyAuth: ProxyAuth{Mode: ProxyAuthRemoteUser}})
+	if err := client.Login(ctx); err != nil || !client.IsLoggedIn() {
+		t.Fatalf("Expected login without the admin form, got %v", err)
+	}
+	if err := client.Add(ctx, AddOptions{URLs: []string{"https://example.org/"}}); err != nil || !reflect.DeepEqual(added, []string{"https://example.org/"}) {
+		t.Errorf("Expected submission, got %q, %v", added, err)
+	}
+	if err := client.Logout(ctx); err != nil || client.IsLoggedIn() {
+		t.Errorf("Expected local logout, got %v", err)
+	}
+}
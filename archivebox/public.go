@@ -0,0 +1,78 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrPublicAddDisabled is returned by Login without credentials if the add form of the instance needs a login,
+// see PUBLIC_ADD_VIEW of archivebox
+var ErrPublicAddDisabled = errors.New("no credentials and the add form of archivebox is not public")
+
+// IsPublicAddEnabled checks whether the add form can be used without login
+func (c *Client) IsPublicAddEnabled(ctx context.Context) (bool, error) {
+	request, err := c.newRequest(ctx, http.MethodGet, addPath, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.do(request)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if isLoginRedirect(resp) {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return true, nil
+}
+
+// the public add form is used without session, the csrf token is taken from the form itself.
+// Must be called with locked mutex.
+func (c *Client) loginAnonymously(ctx context.Context) error {
+	request, err := c.newRequest(ctx, http.MethodGet, addPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	if isLoginRedirect(resp) {
+		resp.Body.Close()
+		return ErrPublicAddDisabled
+	}
+	content, err := readPage(resp)
+	if err != nil {
+		return err
+	}
+	c.csrfMiddlewareToken = parseCSRFMiddlewareToken(content)
+	if len(c.csrfMiddlewareToken) == 0 {
+		return errors.New("cannot find csrfmiddlewaretoken")
+	}
+	if len(c.csrfToken()) == 0 {
+		return errors.New("cannot find csrftoken cookie")
+	}
+	c.isLoggedIn = true
+	c.isAnonymous = true
+	return nil
+}
@@ -0,0 +1,79 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClientWithPublicAddForm(t *testing.T) {
+	var added []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == addPath && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "csrf", Path: "/"})
+			_, _ = w.Write([]byte(`<form><input type="hidden" name="csrfmiddlewaretoken" value="middleware">` +
+				`<textarea name="url"></textarea></form>`))
+		case r.URL.Path == addPath:
+			// the token of the form is posted, not the one of the cookie
+			if token := r.FormValue("csrfmiddlewaretoken"); token != "middleware" {
+				t.Errorf("Expected token of the add form, got %q", token)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			added = append(added, r.FormValue("url"))
+		default:
+			w.Header().Set("Location", loginPath+"?next="+r.URL.Path)
+			w.WriteHeader(http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	client, _ := NewClient(Config{InstanceURL: server.URL})
+	if isPublic, err := client.IsPublicAddEnabled(ctx); err != nil || !isPublic {
+		t.Errorf("Expected public add form, got %v", err)
+	}
+	if err := client.Login(ctx); err != nil || !client.IsLoggedIn() || !client.IsAnonymous() {
+		t.Fatalf("Expected anonymous login, got %v", err)
+	}
+	if err := client.Add(ctx, AddOptions{URLs: []string{"https://example.org/"}}); err != nil || !reflect.DeepEqual(added, []string{"https://example.org/"}) {
+		t.Errorf("Expected anonymous submission, got %q, %v", added, err)
+	}
+	if _, err := client.Tags(ctx); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Expected no tag list without login, got %v", err)
+	}
+	if cookies := client.SessionCookies(); cookies != nil {
+		t.Errorf("Expected no session to resume, got %v", cookies)
+	}
+
+	// the add form of the admin test server needs a login
+	adminServer := newAdminTestServer(t, &added)
+	defer adminServer.Close()
+	client, _ = NewClient(Config{InstanceURL: adminServer.URL})
+	if isPublic, err := client.IsPublicAddEnabled(ctx); err != nil || isPublic {
+		t.Errorf("Expected add form with login, got %v", err)
+	}
+	if err := client.Login(ctx); !errors.Is(err, ErrPublicAddDisabled) {
+		t.Errorf("Expected public add to be disabled, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var csrfMiddlewareTokenPattern = regexp.MustCompile("name=\"csrfmiddlewaretoken\" value=\"(.*?)\"")
+var tagNamePattern = regexp.MustCompile("<t[hd] class=\"field-name\">(?:<a [^>]*>)?(.*?)(?:</a>)?</t[hd]>")
+var tagPagePattern = regexp.MustCompile("href=\"\\?p=([0-9]+)\"")
+var snapshotIDPattern = regexp.MustCompile("name=\"_selected_action\" value=\"([^\"]+)\"")
+var snapshotTimestampPattern = regexp.MustCompile("/archive/([0-9]+(?:\\.[0-9]+)?)/")
+var snapshotURLPattern = regexp.MustCompile("class=\"field-url_str\"[^>]*>\\s*<a href=\"([^\"]+)\"")
+var versionPattern = regexp.MustCompile("v?([0-9]+)\\.([0-9]+)\\.([0-9]+)")
+var pageVersionPatterns = []*regexp.Regexp{
+	// link to the release in the footer
+	regexp.MustCompile("ArchiveBox/releases/tag/(v?[0-9]+\\.[0-9]+\\.[0-9]+)"),
+	regexp.MustCompile("(?i)ArchiveBox(?:</a>)?\\s+(?:version\\s+)?(?:<[^>]*>)?(v?[0-9]+\\.[0-9]+\\.[0-9]+)"),
+}
+var formFieldPattern = regexp.MustCompile("<(?:input|select|textarea)[^>]*\\sname=\"([^\"]+)\"")
+var archiveMethodPattern = regexp.MustCompile("<input[^>]*\\sname=\"archive_methods\"[^>]*\\svalue=\"([^\"]+)\"|" +
+	"<input[^>]*\\svalue=\"([^\"]+)\"[^>]*\\sname=\"archive_methods\"")
+
+func parseCSRFMiddlewareToken(content []byte) string {
+	match := csrfMiddlewareTokenPattern.FindSubmatch(content)
+	if len(match) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(string(match[1]))
+}
+
+// extract the tag names of the admin tag list html
+func parseTagNames(content []byte) []string {
+	var names []string
+	for _, match := range tagNamePattern.FindAllSubmatch(content, -1) {
+		name := strings.TrimSpace(html.UnescapeString(string(match[1])))
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// extract the page numbers of the paginator links in the admin tag list html
+func parseTagListPages(content []byte) []string {
+	var pages []string
+	for _, match := range tagPagePattern.FindAllSubmatch(content, -1) {
+		if _, err := strconv.Atoi(string(match[1])); err == nil {
+			pages = append(pages, string(match[1]))
+		}
+	}
+	return pages
+}
+
+// extract the result rows of the admin snapshot list html
+func parseSnapshots(content []byte) []Snapshot {
+	var snapshots []Snapshot
+	rowStarts := snapshotIDPattern.FindAllSubmatchIndex(content, -1)
+	for i, rowStart := range rowStarts {
+		rowEnd := len(content)
+		if i+1 < len(rowStarts) {
+			rowEnd = rowStarts[i+1][0]
+		}
+		snapshot := Snapshot{ID: string(content[rowStart[2]:rowStart[3]])}
+		// the timestamp is part of the links to the snapshot in the same row
+		if tsMatch := snapshotTimestampPattern.FindSubmatch(content[rowStart[0]:rowEnd]); tsMatch != nil {
+			snapshot.Timestamp = string(tsMatch[1])
+		}
+		// the original url is linked in its own column
+		if urlMatch := snapshotURLPattern.FindSubmatch(content[rowStart[0]:rowEnd]); urlMatch != nil {
+			snapshot.URL = html.UnescapeString(string(urlMatch[1]))
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+// extract the archivebox version of the footer of a page, zero if the page does not show it
+func parseVersionOfPage(content []byte) Version {
+	for _, pattern := range pageVersionPatterns {
+		if match := pattern.FindSubmatch(content); match != nil {
+			if version, ok := ParseVersion(string(match[1])); ok {
+				return version
+			}
+		}
+	}
+	return Version{}
+}
+
+// extract the distinct names of the fields of a form, without the csrf token
+func parseFormFields(content []byte) []string {
+	fields := []string{}
+	for _, match := range formFieldPattern.FindAllSubmatch(content, -1) {
+		name := string(match[1])
+		if name != "csrfmiddlewaretoken" && !slices.Contains(fields, name) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// extract the values of the archive method checkboxes of the add form, nil if there are none
+func parseArchiveMethods(content []byte) []string {
+	var methods []string
+	for _, match := range archiveMethodPattern.FindAllSubmatch(content, -1) {
+		method := string(match[1])
+		if len(method) == 0 {
+			method = string(match[2])
+		}
+		if !slices.Contains(methods, method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
@@ -0,0 +1,61 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTagNames(t *testing.T) {
+	content := []byte(`<tr><th class="field-slug"><a href="/admin/core/tag/1/change/">news</a></th>` +
+		`<td class="field-name">News &amp; Politics</td></tr>` +
+		`<tr><td class="field-name"><a href="/admin/core/tag/2/change/">golang</a></td></tr>` +
+		`<a href="?p=2">3</a> <a href="?p=1">2</a>`)
+	names := parseTagNames(content)
+	expected := []string{"News & Politics", "golang"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	pages := parseTagListPages(content)
+	if !reflect.DeepEqual(pages, []string{"2", "1"}) {
+		t.Errorf("Unexpected pages %v", pages)
+	}
+}
+
+func TestParseSnapshots(t *testing.T) {
+	content := []byte(`<tbody><tr>
+		<td class="action-checkbox"><input type="checkbox" name="_selected_action" value="01HQX3Z" class="action-select"></td>
+		<td class="field-title_str"><a href="/archive/1700000000.123456/index.html">Example</a></td>
+		<td class="field-url_str"><a href="https://example.org/?a=1&amp;b=2"><code style="user-select: all;">https://example.org/?a=1&amp;b=2</code></a></td>
+	</tr><tr>
+		<td class="action-checkbox"><input type="checkbox" name="_selected_action" value="01HQX40" class="action-select"></td>
+		<td class="field-title_str"><a href="/archive/1600000000.5/index.html">Other</a></td>
+	</tr></tbody>`)
+	snapshots := parseSnapshots(content)
+	expected := []Snapshot{{ID: "01HQX3Z", Timestamp: "1700000000.123456", URL: "https://example.org/?a=1&b=2"},
+		{ID: "01HQX40", Timestamp: "1600000000.5"}}
+	if !reflect.DeepEqual(snapshots, expected) {
+		t.Errorf("Expected %v, got %v", expected, snapshots)
+	}
+	if snapshots[0].Time().Unix() != 1700000000 {
+		t.Errorf("Unexpected snapshot time %v", snapshots[0].Time())
+	}
+	if parseSnapshots([]byte(`<span class="small quiet">0 results (<a href="?">3 total</a>)</span>`)) != nil {
+		t.Error("Expected no snapshot for empty result list")
+	}
+}
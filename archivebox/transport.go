@@ -0,0 +1,115 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TLSOptions of the connections to an instance, e.g. for an internal CA or a reverse proxy requiring client certificates
+type TLSOptions struct {
+	// pem file of certificates trusted in addition to the system roots
+	CAFile string
+	// pem files of the client certificate and its key, for mutual tls
+	CertFile string
+	KeyFile  string
+	// base64 encoded sha256 hashes of the subject public key info, optionally prefixed by "sha256/". If there are any,
+	// one of the certificates of the verified chain must have one of these keys. Without verification only the leaf
+	// certificate of the server is checked.
+	PinnedKeys []string
+	// disables the verification of the certificate of the server, pinned keys are still checked
+	InsecureSkipVerify bool
+}
+
+// NewTransport creates a transport with the tls options, the other settings are the ones of http.DefaultTransport
+func NewTransport(options TLSOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: options.InsecureSkipVerify}
+
+	if len(options.CAFile) > 0 {
+		pemCerts, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pemCerts) {
+			return nil, fmt.Errorf("no certificates found in '%s'", options.CAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if len(options.CertFile) > 0 || len(options.KeyFile) > 0 {
+		if len(options.CertFile) == 0 || len(options.KeyFile) == 0 {
+			return nil, errors.New("client certificate and key are both needed")
+		}
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if len(options.PinnedKeys) > 0 {
+		pinnedKeys := map[string]bool{}
+		for _, pinnedKey := range options.PinnedKeys {
+			pinnedKey = strings.TrimPrefix(strings.TrimSpace(pinnedKey), "sha256/")
+			if hash, err := base64.StdEncoding.DecodeString(pinnedKey); err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid pinned key '%s', expected base64 encoded sha256 hash", pinnedKey)
+			}
+			pinnedKeys[pinnedKey] = true
+		}
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			// only certificates of a verified chain or the leaf, whose key signed the handshake, prove anything,
+			// further certificates sent by the server could be appended by anyone
+			var certificates []*x509.Certificate
+			if options.InsecureSkipVerify {
+				if len(state.PeerCertificates) > 0 {
+					certificates = state.PeerCertificates[:1]
+				}
+			} else {
+				for _, chain := range state.VerifiedChains {
+					certificates = append(certificates, chain...)
+				}
+			}
+			for _, certificate := range certificates {
+				if pinnedKeys[PublicKeyHash(certificate)] {
+					return nil
+				}
+			}
+			return errors.New("no certificate of the server matches the pinned keys")
+		}
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// PublicKeyHash of the certificate as used by TLSOptions.PinnedKeys
+func PublicKeyHash(certificate *x509.Certificate) string {
+	hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,148 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package archivebox
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePEM(t *testing.T, path string, blockType string, content []byte) string {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: content}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewTransport(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+	dir := t.TempDir()
+	caFile := writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", server.Certificate().Raw)
+
+	// client certificate
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, _ := x509.MarshalECPrivateKey(key)
+	certFile := writePEM(t, filepath.Join(dir, "client.pem"), "CERTIFICATE", certificate)
+	keyFile := writePEM(t, filepath.Join(dir, "client.key"), "EC PRIVATE KEY", keyBytes)
+
+	ping := func(options TLSOptions) error {
+		transport, err := NewTransport(options)
+		if err != nil {
+			return err
+		}
+		client, _ := NewClient(Config{InstanceURL: server.URL, Transport: transport})
+		return client.Ping(context.Background())
+	}
+	if err := ping(TLSOptions{}); !IsConnectionError(err) {
+		t.Errorf("Expected unknown authority, got %v", err)
+	}
+	if err := ping(TLSOptions{CAFile: caFile}); err != nil {
+		t.Errorf("Expected trusted ca, got %v", err)
+	}
+	if err := ping(TLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("Expected connection without verification, got %v", err)
+	}
+	pinnedKey := "sha256/" + PublicKeyHash(server.Certificate())
+	if err := ping(TLSOptions{CAFile: caFile, PinnedKeys: []string{pinnedKey}}); err != nil {
+		t.Errorf("Expected matching pinned key, got %v", err)
+	}
+	otherKey := PublicKeyHash(&x509.Certificate{RawSubjectPublicKeyInfo: []byte("other")})
+	if err := ping(TLSOptions{InsecureSkipVerify: true, PinnedKeys: []string{otherKey}}); !IsConnectionError(err) {
+		t.Errorf("Expected pinning failure, got %v", err)
+	}
+	if _, err := NewTransport(TLSOptions{PinnedKeys: []string{"invalid"}}); err == nil {
+		t.Errorf("Expected invalid pinned key")
+	}
+
+	// the server answers 403 without client certificate
+	transport, _ := NewTransport(TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected client certificate to be sent, got %v, %v", resp, err)
+	}
+	if _, err = NewTransport(TLSOptions{CertFile: certFile}); err == nil {
+		t.Errorf("Expected missing key error")
+	}
+}
+
+func TestNewTransportPinnedKeyNotInChain(t *testing.T) {
+	newCertificate := func() ([]byte, *ecdsa.PrivateKey) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour),
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}, BasicConstraintsValid: true}
+		certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return certificate, key
+	}
+	pinned, _ := newCertificate()
+	foreign, foreignKey := newCertificate()
+	pinnedCertificate, _ := x509.ParseCertificate(pinned)
+	foreignCertificate, _ := x509.ParseCertificate(foreign)
+
+	// the server owns the foreign key only and appends the pinned certificate to its chain
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{foreign, pinned}, PrivateKey: foreignKey}}}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writePEM(t, filepath.Join(t.TempDir(), "ca.pem"), "CERTIFICATE", foreign)
+
+	ping := func(options TLSOptions) error {
+		transport, err := NewTransport(options)
+		if err != nil {
+			return err
+		}
+		client, _ := NewClient(Config{InstanceURL: server.URL, Transport: transport})
+		return client.Ping(context.Background())
+	}
+	pinnedKey := PublicKeyHash(pinnedCertificate)
+	if err := ping(TLSOptions{InsecureSkipVerify: true, PinnedKeys: []string{pinnedKey}}); !IsConnectionError(err) {
+		t.Errorf("Expected pinning failure without verification, got %v", err)
+	}
+	if err := ping(TLSOptions{CAFile: caFile, PinnedKeys: []string{pinnedKey}}); !IsConnectionError(err) {
+		t.Errorf("Expected pinning failure with verification, got %v", err)
+	}
+	if err := ping(TLSOptions{CAFile: caFile, PinnedKeys: []string{PublicKeyHash(foreignCertificate)}}); err != nil {
+		t.Errorf("Expected matching pinned key of the leaf, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// currently selected archive methods, empty means all methods enabled on the server are used,
+// initialized with the archive methods of the active profile
+var selectedArchiveMethods []string
+
+// the selection is stored as default of the active profile
+func saveSelectedArchiveMethods(methods []string) {
+	selectedArchiveMethods = sortArchiveMethods(methods)
+	updateCurrentProfile(func(profile *instanceProfile) {
+		profile.ArchiveMethods = selectedArchiveMethods
+	})
+}
+
+// named selections of archive methods, e.g. "article only"
+func loadArchiveMethodPresets() map[string][]string {
+	presets := map[string][]string{}
+	presetsJSON := fyneApplication.Preferences().StringWithFallback(preferenceArchiveMethodPresets, "")
+	if len(presetsJSON) == 0 {
+		return presets
+	}
+	if err := json.Unmarshal([]byte(presetsJSON), &presets); err != nil {
+		log.Printf("Problem reading archive method presets: %v\n", err)
+		return map[string][]string{}
+	}
+	return presets
+}
+
+func saveArchiveMethodPresets(presets map[string][]string) {
+	presetsJSON, err := json.Marshal(presets)
+	if err != nil {
+		log.Printf("Problem saving archive method presets: %v\n", err)
+		return
+	}
+	fyneApplication.Preferences().SetString(preferenceArchiveMethodPresets, string(presetsJSON))
+}
+
+func archiveMethodPresetNames(presets map[string][]string) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bring methods into the order of archivebox.ArchiveMethods and drop unknown ones
+func sortArchiveMethods(methods []string) []string {
+	sorted := []string{}
+	for _, method := range archivebox.ArchiveMethods {
+		for _, m := range methods {
+			if m == method {
+				sorted = append(sorted, method)
+				break
+			}
+		}
+	}
+	return sorted
+}
+
+// short description of the archive method selection, prefers the name of a matching preset
+func archiveMethodsSummary(methods []string, presets map[string][]string) string {
+	if len(methods) == 0 {
+		return t("AllArchiveMethods")
+	}
+	joined := strings.Join(sortArchiveMethods(methods), ",")
+	for _, name := range archiveMethodPresetNames(presets) {
+		if strings.Join(sortArchiveMethods(presets[name]), ",") == joined {
+			return name
+		}
+	}
+	return strings.Join(sortArchiveMethods(methods), ", ")
+}
@@ -0,0 +1,37 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArchiveMethodsSummary(t *testing.T) {
+	sorted := sortArchiveMethods([]string{"media", "unknown", "pdf", "title"})
+	if !reflect.DeepEqual(sorted, []string{"title", "pdf", "media"}) {
+		t.Errorf("Unexpected order of archive methods: %v", sorted)
+	}
+
+	presets := map[string][]string{"article only": {"readability", "singlefile"}}
+	if summary := archiveMethodsSummary([]string{"singlefile", "readability"}, presets); summary != "article only" {
+		t.Errorf("Expected preset name, got '%s'", summary)
+	}
+	if summary := archiveMethodsSummary([]string{"pdf", "title"}, presets); summary != "title, pdf" {
+		t.Errorf("Expected list of methods, got '%s'", summary)
+	}
+}
@@ -0,0 +1,200 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"log"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// split the input into its trimmed, non-empty lines
+func splitInputLines(input string) []string {
+	var lines []string
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// true if there is exactly one url candidate per line, otherwise the input is treated as arbitrary text
+func isURLPerLine(lines []string) bool {
+	if len(lines) < 2 {
+		return false
+	}
+	for _, line := range lines {
+		if len(strings.Fields(line)) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// submits the urls one after another and shows the progress of each url in a dialog
+func submitURLBatch(urls []string, options submissionOptions) {
+	appSessionState.IsBatchRunning.setTrue()
+	// closing the window would quit the app in the middle of the batch
+	appSessionState.IsCloseBlocked.setTrue()
+	log.Printf("Started batch archiving of %d urls\n", len(urls))
+	// there is no outlink preview for each url of a batch, archivebox must not crawl outlinks nobody has seen
+	isDepthIgnored := options.Depth > 0
+	options.Depth = 0
+
+	statusLabels := make([]*widget.Label, len(urls))
+	rows := container.NewVBox()
+	for i, u := range urls {
+		statusLabels[i] = widget.NewLabel(t("BatchPending"))
+		urlLabel := widget.NewLabel(u)
+		urlLabel.Truncation = fyne.TextTruncateEllipsis
+		rows.Add(container.NewBorder(nil, nil, nil, statusLabels[i], urlLabel))
+	}
+	progressBar := widget.NewProgressBar()
+	progressBar.Max = float64(len(urls))
+
+	header := container.NewVBox(progressBar)
+	if isDepthIgnored {
+		depthLabel := widget.NewLabel(t("BatchWithoutOutlinks"))
+		depthLabel.Wrapping = fyne.TextWrapWord
+		header.Add(depthLabel)
+	}
+	progressDialog := dialog.NewCustom(t("BatchSubmission"), t("Close"),
+		container.NewBorder(header, nil, nil, nil, container.NewVScroll(rows)), window)
+	progressDialog.SetOnClosed(func() {
+		window.Resize(windowSize)
+	})
+	window.Resize(fyne.Size{
+		Width:  750,
+		Height: 550,
+	})
+	progressDialog.Resize(fyne.Size{
+		Width:  700,
+		Height: 500,
+	})
+	progressDialog.Show()
+
+	inputEntryWidget.Disable()
+	addToArchiveBtn.Disable()
+	infoLabel.SetText("")
+
+	go func() {
+		checkAfterAddPref := fyneApplication.Preferences().BoolWithFallback(preferenceCheckAdd, false)
+		confirmPref := fyneApplication.Preferences().BoolWithFallback(preferenceConfirmSubmission, false)
+		var failedURLs []string
+		queuedURLs := 0
+		for i, u := range urls {
+			fyne.Do(func() {
+				statusLabels[i].SetText(t("BatchSending"))
+			})
+			status := t("URLSent")
+			var existingSnapshots []archivebox.Snapshot
+			if confirmPref {
+				existingSnapshots = snapshotsBeforeSubmission(u)
+			}
+			results := sendURLToInstances(u, options, func(instanceURL string, attempt int, maxAttempts int, err error) {
+				fyne.Do(func() {
+					statusLabels[i].SetText(tWithArgs("BatchRetrying", struct {
+						Attempt     int
+						MaxAttempts int
+					}{Attempt: attempt, MaxAttempts: maxAttempts}))
+				})
+			})
+			queued := queueUnreachableInstances(u, options, results)
+			failure := instanceFailure(results)
+			if failure != nil {
+				log.Printf("Problem archiving url '%s': %v\n", u, failure)
+				failedURLs = append(failedURLs, u)
+				status = tWithArgs("BatchFailed", struct {
+					ERROR string
+				}{ERROR: localizeError(failure)})
+			} else if queued == len(results) {
+				queuedURLs++
+				status = t("URLQueuedShort")
+			} else if queued == 0 && confirmPref && len(existingSnapshots) > 0 {
+				// archivebox creates no new snapshot of a url archived before
+				status = tWithArgs("SnapshotAlreadyArchived", struct {
+					ID   string
+					Time string
+				}{ID: existingSnapshots[0].ID, Time: formatSnapshotTime(&existingSnapshots[0])})
+			} else if queued == 0 && confirmPref {
+				status = t("WaitingForConfirmationShort")
+				trackSubmission(u, nil, func(snapshot *archivebox.Snapshot, isAlreadyArchived bool) {
+					fyne.Do(func() {
+						statusLabels[i].SetText(tWithArgs("SnapshotConfirmed", struct {
+							ID   string
+							Time string
+						}{ID: snapshot.ID, Time: formatSnapshotTime(snapshot)}))
+					})
+				}, func() {
+					fyne.Do(func() {
+						statusLabels[i].SetText(t("URLNotVerified"))
+					})
+				})
+			} else if queued == 0 && checkAfterAddPref {
+				if isURLAlreadyArchived(u) {
+					status = t("URLAdded")
+				} else {
+					status = t("URLNotVerified")
+				}
+			}
+			if len(results) > 1 && (failure != nil || queued > 0) {
+				// per instance outcome of the mirrored submission
+				status = strings.ReplaceAll(instanceResultsText(results), "\n", "; ")
+			}
+			fyne.Do(func() {
+				statusLabels[i].SetText(status)
+				progressBar.SetValue(float64(i + 1))
+			})
+		}
+
+		summary := tWithArgs("BatchFinished", struct {
+			Succeeded int
+			Total     int
+			Failed    int
+			Queued    int
+		}{Succeeded: len(urls) - len(failedURLs) - queuedURLs, Total: len(urls), Failed: len(failedURLs), Queued: queuedURLs})
+		fyneApplication.SendNotification(&fyne.Notification{
+			Title: tWithArgs("NotificationTitle", struct {
+				APP_NAME string
+			}{APP_NAME: appConfig.AppName}),
+			Content: summary,
+		})
+		log.Println(summary)
+
+		closeAppPref := fyneApplication.Preferences().BoolWithFallback(preferenceCloseAfterAdd, false)
+		fyne.Do(func() {
+			appSessionState.IsBatchRunning.setFalse()
+			appSessionState.IsCloseBlocked.setFalse()
+			if len(failedURLs) == 0 && closeAppPref {
+				quitApp()
+				return
+			}
+			// keep the failed urls in the input to allow a retry
+			inputEntryWidget.SetText(strings.Join(failedURLs, "\n"))
+			infoLabel.SetText(summary)
+			inputEntryWidget.Enable()
+			addToArchiveBtn.Enable()
+		})
+	}()
+}
@@ -0,0 +1,39 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitInputLines(t *testing.T) {
+	lines := splitInputLines(" https://a.org \n\n\thttps://b.org/x\r\nhttps://c.org\n ")
+	expected := []string{"https://a.org", "https://b.org/x", "https://c.org"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+	if !isURLPerLine(lines) {
+		t.Error("Expected one url per line")
+	}
+	if isURLPerLine(lines[:1]) {
+		t.Error("Expected a single line not to be a batch")
+	}
+	if isURLPerLine(splitInputLines("see https://a.org\nand https://b.org")) {
+		t.Error("Expected text lines not to be a batch")
+	}
+}
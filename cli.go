@@ -0,0 +1,398 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// exit codes of the cli commands
+const (
+	exitCodeSuccess         = 0 // all urls added, all urls archived, search or login worked
+	exitCodeFailed          = 1
+	exitCodeUsage           = 2
+	exitCodeAlreadyArchived = 3 // add: none of the urls was added because all of them are archived already
+	exitCodeNotArchived     = 4 // check: at least one url is not archived
+)
+
+// status of an url in the output of the cli commands
+const (
+	cliStatusAdded           = "added"
+	cliStatusAlreadyArchived = "already_archived"
+	cliStatusArchived        = "archived"
+	cliStatusNotArchived     = "not_archived"
+	cliStatusFailed          = "failed"
+	cliStatusLoggedIn        = "logged_in"
+)
+
+var cliCommands = map[string]func(args []string, output io.Writer) int{
+	"add":        runAddCommand,
+	"check":      runCheckCommand,
+	"search":     runSearchCommand,
+	"login-test": runLoginTestCommand,
+}
+
+// one line of the cli output, printed as json object with --json
+type cliResult struct {
+	URL         string `json:"url,omitempty"`
+	Line        int    `json:"line,omitempty"` // line of the url in the input file
+	Status      string `json:"status"`
+	SnapshotID  string `json:"snapshot_id,omitempty"`
+	Timestamp   string `json:"timestamp,omitempty"`
+	InstanceURL string `json:"instance_url,omitempty"`
+	UsesAPI     bool   `json:"uses_api,omitempty"`
+	Version     string `json:"version,omitempty"` // archivebox version of the instance
+	Error       string `json:"error,omitempty"`
+}
+
+func isCLICommand(arg string) bool {
+	_, ok := cliCommands[arg]
+	return ok
+}
+
+// runs the command without any window, returns the exit code
+func runCLICommand(command string, args []string, output io.Writer) int {
+	if isCredentialStoreLocked() {
+		fmt.Fprintf(os.Stderr, "The credentials are locked, set the master passphrase in %s\n", passphraseEnvVariable)
+		return exitCodeFailed
+	}
+	if err := credentialStoreProblem(); errors.Is(err, errCredentialStoreUnavailable) {
+		fmt.Fprintln(os.Stderr, tWithArgs("CredentialStoreUnavailable", struct {
+			ERROR string
+		}{ERROR: err.Error()}))
+	}
+	defer doArchiveBoxLogout()
+	return cliCommands[command](args, output)
+}
+
+// writes the results as json lines or as tab separated text, safe for concurrent use
+type cliPrinter struct {
+	output io.Writer
+	isJSON bool
+	mutex  sync.Mutex
+}
+
+func (p *cliPrinter) print(result cliResult) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.isJSON {
+		if err := json.NewEncoder(p.output).Encode(result); err != nil {
+			log.Printf("Problem writing result: %v\n", err)
+		}
+		return
+	}
+	var columns []string
+	for _, column := range []string{result.Status, result.URL, result.InstanceURL, result.Version, result.SnapshotID, result.Timestamp, result.Error} {
+		if len(column) > 0 {
+			columns = append(columns, column)
+		}
+	}
+	_, _ = fmt.Fprintln(p.output, strings.Join(columns, "\t"))
+}
+
+func newCLIFlagSet(command string, usage string) (*flag.FlagSet, *bool) {
+	flagSet := flag.NewFlagSet(command, flag.ContinueOnError)
+	flagSet.Usage = func() {
+		_, _ = fmt.Fprintf(flagSet.Output(), "Usage: %s %s %s\n", os.Args[0], command, usage)
+		flagSet.PrintDefaults()
+	}
+	isJSON := flagSet.Bool("json", false, "print one json object per line")
+	flagSet.String("profile", "", "name of the instance profile to use (default: profile selected in the app)")
+	return flagSet, isJSON
+}
+
+// parse the arguments and activate the selected profile, false for invalid usage
+func parseCLIFlags(flagSet *flag.FlagSet, args []string) bool {
+	if err := flagSet.Parse(args); err != nil {
+		return false
+	}
+	if profile := flagSet.Lookup("profile").Value.String(); len(profile) > 0 {
+		if err := activateProfile(profile); err != nil {
+			_, _ = fmt.Fprintln(flagSet.Output(), err)
+			return false
+		}
+	}
+	return true
+}
+
+// repeatable flag, each value may contain a comma separated list
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, parseTags(value)...)
+	return nil
+}
+
+// login with the configured credentials, the error is printed for every given url
+func connectCLI(printer *cliPrinter, urls []string) bool {
+	err := setupArchiveBoxConnection()
+	if err == nil {
+		return true
+	}
+	if len(urls) == 0 {
+		urls = []string{""}
+	}
+	for _, u := range urls {
+		printer.print(cliResult{URL: u, Status: cliStatusFailed, Error: localizeError(err)})
+	}
+	return false
+}
+
+func runAddCommand(args []string, output io.Writer) int {
+	flagSet, isJSON := newCLIFlagSet("add", "[options] URL...")
+	var tags stringListFlag
+	flagSet.Var(&tags, "tag", "tag of the snapshots, repeatable or comma separated (default: tags of the profile)")
+	depth := flagSet.Int("depth", 0, "crawl depth of the submission, 0 or 1")
+	var methods stringListFlag
+	flagSet.Var(&methods, "method", "archive method, repeatable or comma separated (default: methods of the profile)")
+	parser := flagSet.String("parser", fyneApplication.Preferences().StringWithFallback(preferenceParser, archivebox.DefaultParser),
+		"parser of the submitted urls")
+	fromFile := flagSet.String("from-file", "", "read newline separated urls from the file, - for stdin")
+	concurrency := flagSet.Int("concurrency", defaultCLIConcurrency, "maximum number of parallel submissions")
+	rate := flagSet.Float64("rate", defaultCLIRate, "maximum number of submissions per second, 0 for no limit")
+	if !parseCLIFlags(flagSet, args) {
+		return exitCodeUsage
+	}
+	var urls []string
+	for _, arg := range flagSet.Args() {
+		if arg == "-" {
+			*fromFile = "-"
+		} else {
+			urls = append(urls, arg)
+		}
+	}
+	if (len(urls) == 0 && len(*fromFile) == 0) || (*depth != 0 && *depth != 1) || *concurrency < 1 || *rate < 0 {
+		flagSet.Usage()
+		return exitCodeUsage
+	}
+	options := submissionOptions{Tags: tags, Depth: *depth, ArchiveMethods: methods, Parser: *parser}
+	if len(tags) == 0 {
+		options.Tags = currentProfile().Tags
+	}
+	if len(methods) == 0 {
+		options.ArchiveMethods = selectedArchiveMethods
+	} else if len(sortArchiveMethods(methods)) != len(methods) {
+		_, _ = fmt.Fprintf(flagSet.Output(), "Unknown archive method in '%s', available: %s\n",
+			methods.String(), strings.Join(archivebox.ArchiveMethods, ", "))
+		return exitCodeUsage
+	}
+
+	var input io.Reader
+	switch *fromFile {
+	case "":
+	case "-":
+		input = cliInput
+	default:
+		file, err := os.Open(*fromFile)
+		if err != nil {
+			_, _ = fmt.Fprintln(flagSet.Output(), err)
+			return exitCodeUsage
+		}
+		defer file.Close()
+		input = file
+	}
+
+	printer := &cliPrinter{output: output, isJSON: *isJSON}
+	if !connectCLI(printer, urls) {
+		return exitCodeFailed
+	}
+	lines := make(chan inputLine)
+	var readErr error
+	go func() {
+		defer close(lines)
+		for _, u := range urls {
+			lines <- inputLine{Text: u}
+		}
+		if input != nil {
+			readErr = readInputLines(input, lines)
+		}
+	}()
+	statuses := addURLs(lines, options, *concurrency, *rate, printer)
+	if readErr != nil {
+		log.Printf("Problem reading urls: %v\n", readErr)
+		return exitCodeFailed
+	}
+	return addExitCode(statuses)
+}
+
+// submit the url to each instance of the profile which has not archived it yet, one result per instance
+func addURL(urlToSave string, options submissionOptions) []cliResult {
+	if !isURL(urlToSave) {
+		return []cliResult{{URL: urlToSave, Status: cliStatusFailed, Error: t("InvalidURL")}}
+	}
+	sessions := activeSessions()
+	results := make([]cliResult, len(sessions))
+	var wg sync.WaitGroup
+	for i, session := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = addURLToInstance(session, urlToSave, options)
+			if len(sessions) > 1 {
+				// the instance is only part of the output of mirrored submissions
+				results[i].InstanceURL = session.target.InstanceURL
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func addURLToInstance(session *instanceSession, urlToSave string, options submissionOptions) cliResult {
+	if session.connect() == nil {
+		// only a snapshot of exactly the url is skipped, not the ones of longer urls found by the admin search
+		if snapshot, err := session.findSnapshot(urlToSave); err == nil && snapshot != nil {
+			return cliResult{URL: urlToSave, Status: cliStatusAlreadyArchived, SnapshotID: snapshot.ID, Timestamp: snapshot.Timestamp}
+		}
+	}
+	// connection problems are retried
+	_, err := sendURLWithRetries(session, urlToSave, options, func(attempt int, maxAttempts int, err error) {
+		log.Println(retryText(attempt, maxAttempts, err))
+	})
+	if err != nil {
+		return cliResult{URL: urlToSave, Status: cliStatusFailed, Error: localizeError(err)}
+	}
+	return cliResult{URL: urlToSave, Status: cliStatusAdded}
+}
+
+func addExitCode(statuses []string) int {
+	isAllArchived := len(statuses) > 0
+	for _, status := range statuses {
+		if status == cliStatusFailed {
+			return exitCodeFailed
+		}
+		if status != cliStatusAlreadyArchived {
+			isAllArchived = false
+		}
+	}
+	if isAllArchived {
+		return exitCodeAlreadyArchived
+	}
+	return exitCodeSuccess
+}
+
+func runCheckCommand(args []string, output io.Writer) int {
+	flagSet, isJSON := newCLIFlagSet("check", "[options] URL...")
+	if !parseCLIFlags(flagSet, args) {
+		return exitCodeUsage
+	}
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		return exitCodeUsage
+	}
+	printer := &cliPrinter{output: output, isJSON: *isJSON}
+	if !connectCLI(printer, flagSet.Args()) {
+		return exitCodeFailed
+	}
+	exitCode := exitCodeSuccess
+	for _, u := range flagSet.Args() {
+		u = strings.TrimSpace(u)
+		if !isURL(u) {
+			printer.print(cliResult{URL: u, Status: cliStatusFailed, Error: t("InvalidURL")})
+			exitCode = exitCodeFailed
+			continue
+		}
+		snapshot, err := findSnapshot(u)
+		switch {
+		case err != nil:
+			printer.print(cliResult{URL: u, Status: cliStatusFailed, Error: localizeError(err)})
+			exitCode = exitCodeFailed
+		case snapshot == nil:
+			printer.print(cliResult{URL: u, Status: cliStatusNotArchived})
+			if exitCode == exitCodeSuccess {
+				exitCode = exitCodeNotArchived
+			}
+		default:
+			printer.print(cliResult{URL: u, Status: cliStatusArchived, SnapshotID: snapshot.ID, Timestamp: snapshot.Timestamp})
+		}
+	}
+	return exitCode
+}
+
+func runSearchCommand(args []string, output io.Writer) int {
+	flagSet, isJSON := newCLIFlagSet("search", "[options] QUERY")
+	if !parseCLIFlags(flagSet, args) {
+		return exitCodeUsage
+	}
+	query := strings.TrimSpace(strings.Join(flagSet.Args(), " "))
+	if len(query) == 0 {
+		flagSet.Usage()
+		return exitCodeUsage
+	}
+	printer := &cliPrinter{output: output, isJSON: *isJSON}
+	if !connectCLI(printer, nil) {
+		return exitCodeFailed
+	}
+	client, err := primarySession().getClient()
+	if err != nil {
+		printer.print(cliResult{Status: cliStatusFailed, Error: localizeError(err)})
+		return exitCodeFailed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+	snapshots, err := client.Search(ctx, query)
+	if err != nil {
+		printer.print(cliResult{Status: cliStatusFailed, Error: localizeError(err)})
+		return exitCodeFailed
+	}
+	for _, snapshot := range snapshots {
+		printer.print(cliResult{URL: snapshot.URL, Status: cliStatusArchived, SnapshotID: snapshot.ID, Timestamp: snapshot.Timestamp})
+	}
+	return exitCodeSuccess
+}
+
+func runLoginTestCommand(args []string, output io.Writer) int {
+	flagSet, isJSON := newCLIFlagSet("login-test", "[options]")
+	if !parseCLIFlags(flagSet, args) {
+		return exitCodeUsage
+	}
+	printer := &cliPrinter{output: output, isJSON: *isJSON}
+	// the instance and all mirrors of the profile
+	exitCode := exitCodeSuccess
+	for _, session := range activeSessions() {
+		client, err := session.getClient()
+		if err == nil {
+			err = session.connect()
+		}
+		if err != nil {
+			printer.print(cliResult{InstanceURL: session.target.InstanceURL, Status: cliStatusFailed, Error: localizeError(err)})
+			exitCode = exitCodeFailed
+			continue
+		}
+		result := cliResult{InstanceURL: client.InstanceURL(), Status: cliStatusLoggedIn, UsesAPI: client.UsesAPI()}
+		if capabilities := client.Capabilities(); !capabilities.Version.IsZero() {
+			result.Version = capabilities.Version.String()
+		}
+		printer.print(result)
+	}
+	return exitCode
+}
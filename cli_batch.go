@@ -0,0 +1,116 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaults of the cli submission of many urls, e.g. read from a file
+const (
+	defaultCLIConcurrency = 2
+	defaultCLIRate        = 1.0 // submissions per second
+)
+
+// input of the add command, replaced in tests
+var cliInput io.Reader = os.Stdin
+
+// url of an input line, the number is 0 for urls given as arguments
+type inputLine struct {
+	Number int
+	Text   string
+}
+
+// send the non-empty lines of the input to the channel, lines starting with # are comments
+func readInputLines(input io.Reader, lines chan<- inputLine) error {
+	scanner := bufio.NewScanner(input)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		lines <- inputLine{Number: number, Text: text}
+	}
+	return scanner.Err()
+}
+
+// limits the start of operations to the given rate per second, there is no limit for a rate of 0
+type rateLimiter struct {
+	interval time.Duration
+	mutex    sync.Mutex
+	next     time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// blocks until the next operation may start, the first one starts immediately
+func (l *rateLimiter) wait() {
+	if l.interval <= 0 {
+		return
+	}
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mutex.Unlock()
+	time.Sleep(delay)
+}
+
+// add the urls of the lines with limited concurrency and rate, results are printed as soon as they are known
+func addURLs(lines <-chan inputLine, options submissionOptions, concurrency int, rate float64, printer *cliPrinter) []string {
+	limiter := newRateLimiter(rate)
+
+	var statuses []string
+	var statusMutex sync.Mutex
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for line := range lines {
+				if isURL(line.Text) {
+					// invalid lines are reported without waiting for the rate limit
+					limiter.wait()
+				}
+				for _, result := range addURL(line.Text, options) {
+					result.Line = line.Number
+					printer.print(result)
+					statusMutex.Lock()
+					statuses = append(statuses, result.Status)
+					statusMutex.Unlock()
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	return statuses
+}
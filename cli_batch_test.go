@@ -0,0 +1,122 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestReadInputLines(t *testing.T) {
+	lines := make(chan inputLine)
+	go func() {
+		defer close(lines)
+		_ = readInputLines(strings.NewReader("https://example.org/\n\n# comment\n  no url \r\nhttps://example.com/"), lines)
+	}()
+	var result []inputLine
+	for line := range lines {
+		result = append(result, line)
+	}
+	expected := []inputLine{{Number: 1, Text: "https://example.org/"}, {Number: 4, Text: "no url"}, {Number: 5, Text: "https://example.com/"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(20)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.wait()
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected two intervals of 50ms, waited %v", elapsed)
+	}
+	start = time.Now()
+	newRateLimiter(0).wait()
+	if time.Since(start) > 10*time.Millisecond {
+		t.Error("Expected no limit")
+	}
+}
+
+func TestAddCommandFromStdin(t *testing.T) {
+	var addedURLs []string
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/auth/check_api_token":
+			_, _ = w.Write([]byte(`{"success": true}`))
+		case "/api/v1/cli/add":
+			var body struct {
+				URLs []string `json:"urls"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			mutex.Lock()
+			addedURLs = append(addedURLs, body.URLs...)
+			mutex.Unlock()
+		case "/api/v1/core/snapshots":
+			_, _ = w.Write([]byte(`{"items": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	fyneApplication = test.NewApp()
+	appConfig.initI18n()
+	saveProfiles(map[string]instanceProfile{defaultProfileName: {instanceTarget: instanceTarget{InstanceURL: server.URL, APIKey: "secret"}}})
+	if err := activateProfile(defaultProfileName); err != nil {
+		t.Fatal(err)
+	}
+
+	cliInput = strings.NewReader("https://example.org/1\nhttps://example.org/2\nftp://example.org/\nhttps://example.org/3\n")
+	defer func() {
+		cliInput = nil
+	}()
+	var output bytes.Buffer
+	exitCode := runCLICommand("add", []string{"--json", "--concurrency", "2", "--rate", "0", "-", "https://example.org/0"}, &output)
+	if exitCode != exitCodeFailed {
+		t.Errorf("Expected failure of the invalid line, got %d", exitCode)
+	}
+	sort.Strings(addedURLs)
+	expected := []string{"https://example.org/0", "https://example.org/1", "https://example.org/2", "https://example.org/3"}
+	if !reflect.DeepEqual(addedURLs, expected) {
+		t.Errorf("Expected submissions %v, got %v", expected, addedURLs)
+	}
+	results := map[int]cliResult{}
+	decoder := json.NewDecoder(&output)
+	for decoder.More() {
+		var result cliResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		results[result.Line] = result
+	}
+	if len(results) != 5 || results[3].Status != cliStatusFailed || results[4].Status != cliStatusAdded {
+		t.Errorf("Unexpected results %v", results)
+	}
+}
@@ -0,0 +1,166 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestAddExitCode(t *testing.T) {
+	for expected, statuses := range map[int][]string{
+		exitCodeSuccess:         {cliStatusAdded, cliStatusAlreadyArchived},
+		exitCodeAlreadyArchived: {cliStatusAlreadyArchived, cliStatusAlreadyArchived},
+		exitCodeFailed:          {cliStatusAdded, cliStatusFailed},
+	} {
+		if exitCode := addExitCode(statuses); exitCode != expected {
+			t.Errorf("Expected exit code %d for %v, got %d", expected, statuses, exitCode)
+		}
+	}
+}
+
+// the cli commands with an archivebox instance providing the rest api
+func TestCLICommands(t *testing.T) {
+	var addedURLs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/auth/check_api_token":
+			_, _ = w.Write([]byte(`{"success": true}`))
+		case "/api/v1/cli/add":
+			var body struct {
+				URLs []string `json:"urls"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			addedURLs = append(addedURLs, body.URLs...)
+		case "/api/v1/core/snapshots":
+			if r.URL.Query().Get("url") == "https://example.org/archived" || r.URL.Query().Get("search") == "example" {
+				_, _ = w.Write([]byte(`{"items": [{"id": "01J0", "timestamp": "1700000000.1", "url": "https://example.org/archived"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"items": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	fyneApplication = test.NewApp()
+	appConfig.initI18n()
+	saveProfiles(map[string]instanceProfile{defaultProfileName: {instanceTarget: instanceTarget{InstanceURL: server.URL, APIKey: "secret"}}})
+	if err := activateProfile(defaultProfileName); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if exitCode := runCLICommand("add", []string{"--json", "--tag", "a,b", "https://example.org/archived"}, &output); exitCode != exitCodeAlreadyArchived {
+		t.Errorf("Expected already archived, got %d: %s", exitCode, output.String())
+	}
+	output.Reset()
+	if exitCode := runCLICommand("add", []string{"--rate", "0", "--concurrency", "1", "https://example.org/new", "https://example.org/archived"}, &output); exitCode != exitCodeSuccess {
+		t.Errorf("Expected success, got %d: %s", exitCode, output.String())
+	}
+	if len(addedURLs) != 1 || addedURLs[0] != "https://example.org/new" {
+		t.Errorf("Unexpected submissions %v", addedURLs)
+	}
+	if !strings.HasPrefix(output.String(), "added\thttps://example.org/new\nalready_archived\thttps://example.org/archived\t01J0") {
+		t.Errorf("Unexpected output %q", output.String())
+	}
+	output.Reset()
+	if exitCode := runCLICommand("add", []string{"no url"}, &output); exitCode != exitCodeFailed {
+		t.Errorf("Expected failure, got %d: %s", exitCode, output.String())
+	}
+
+	output.Reset()
+	if exitCode := runCLICommand("check", []string{"--json", "https://example.org/archived"}, &output); exitCode != exitCodeSuccess {
+		t.Errorf("Expected archived url, got %d: %s", exitCode, output.String())
+	}
+	var result cliResult
+	if err := json.Unmarshal(output.Bytes(), &result); err != nil || result.Status != cliStatusArchived || result.SnapshotID != "01J0" {
+		t.Errorf("Unexpected check result %v, %v", result, err)
+	}
+	if exitCode := runCLICommand("check", []string{"https://example.org/missing"}, &output); exitCode != exitCodeNotArchived {
+		t.Errorf("Expected url not to be archived, got %d", exitCode)
+	}
+	output.Reset()
+	if exitCode := runCLICommand("search", []string{"example"}, &output); exitCode != exitCodeSuccess ||
+		!strings.Contains(output.String(), "01J0") {
+		t.Errorf("Unexpected search result %d: %s", exitCode, output.String())
+	}
+	if exitCode := runCLICommand("add", []string{"--depth", "2", "https://example.org/"}, &output); exitCode != exitCodeUsage {
+		t.Errorf("Expected usage error, got %d", exitCode)
+	}
+}
+
+// the admin search matches parts of the url, only snapshots of exactly the url count
+func TestCLICommandsWithAdminLogin(t *testing.T) {
+	var addedURLs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/admin/login/" && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "csrf", Path: "/"})
+			_, _ = w.Write([]byte(`<input type="hidden" name="csrfmiddlewaretoken" value="middleware">`))
+		case r.URL.Path == "/admin/login/":
+			http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "session", Path: "/"})
+			w.Header().Set("Location", "/")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == "/add/" && r.Method == http.MethodPost:
+			addedURLs = append(addedURLs, r.FormValue("url"))
+		case r.URL.Path == "/admin/core/snapshot/" && strings.HasPrefix(r.URL.Query().Get("q"), "https://example.org/"):
+			_, _ = w.Write([]byte(`<tr><td><input type="checkbox" name="_selected_action" value="01J0"></td>` +
+				`<td class="field-title_str"><a href="/archive/1700000000.1/index.html">Example</a></td>` +
+				`<td class="field-url_str"><a href="https://example.org/archived/page"><code>https://example.org/archived/page</code></a></td></tr>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	fyneApplication = test.NewApp()
+	appConfig.initI18n()
+	credentials = newMemoryCredentialStore()
+	saveProfiles(map[string]instanceProfile{defaultProfileName: {
+		instanceTarget: instanceTarget{InstanceURL: server.URL, Username: "admin", Password: "secret"},
+	}})
+	if err := activateProfile(defaultProfileName); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if exitCode := runCLICommand("add", []string{"https://example.org/archived"}, &output); exitCode != exitCodeSuccess ||
+		len(addedURLs) != 1 {
+		t.Errorf("Expected submission of the url with a longer archived url, got %d, %v: %s", exitCode, addedURLs, output.String())
+	}
+	output.Reset()
+	if exitCode := runCLICommand("check", []string{"https://example.org/archived"}, &output); exitCode != exitCodeNotArchived {
+		t.Errorf("Expected url not to be archived, got %d: %s", exitCode, output.String())
+	}
+	output.Reset()
+	if exitCode := runCLICommand("check", []string{"https://example.org/archived/page"}, &output); exitCode != exitCodeSuccess {
+		t.Errorf("Expected archived url, got %d: %s", exitCode, output.String())
+	}
+	output.Reset()
+	if exitCode := runCLICommand("search", []string{"https://example.org/"}, &output); exitCode != exitCodeSuccess ||
+		!strings.HasPrefix(output.String(), "archived\thttps://example.org/archived/page\t01J0") {
+		t.Errorf("Expected url of the search result, got %d: %q", exitCode, output.String())
+	}
+}
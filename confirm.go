@@ -0,0 +1,142 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+const (
+	confirmationPollInterval = 5 * time.Second
+	confirmationTimeout      = 10 * time.Minute
+)
+
+// running confirmations, the app is kept alive in background until they are finished
+var runningConfirmations sync.WaitGroup
+
+func formatSnapshotTime(snapshot *archivebox.Snapshot) string {
+	snapshotTime := snapshot.Time()
+	if snapshotTime.IsZero() {
+		return snapshot.Timestamp
+	}
+	return snapshotTime.Format("2006-01-02 15:04:05")
+}
+
+func findSnapshot(urlToCheck string) (*archivebox.Snapshot, error) {
+	return primarySession().findSnapshot(urlToCheck)
+}
+
+// snapshots of the url before it is submitted, nil if they cannot be looked up
+func snapshotsBeforeSubmission(urlToCheck string) []archivebox.Snapshot {
+	session := primarySession()
+	if session.isAnonymous() {
+		return nil
+	}
+	snapshots, err := session.findSnapshots(urlToCheck)
+	if err != nil {
+		log.Printf("Problem checking snapshot of '%s': %v\n", urlToCheck, err)
+	}
+	return snapshots
+}
+
+// the newest of the snapshots existing before the submission, archivebox does not create another one for the url then.
+// Otherwise findSnapshots is polled until there is one, nil if there is none until the timeout.
+// The second result is true if the url was archived before.
+func waitForSnapshot(urlToCheck string, existingSnapshots []archivebox.Snapshot,
+	findSnapshots func(string) ([]archivebox.Snapshot, error), interval time.Duration, timeout time.Duration) (*archivebox.Snapshot, bool) {
+	if len(existingSnapshots) > 0 {
+		return &existingSnapshots[0], true
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		snapshots, err := findSnapshots(urlToCheck)
+		if err != nil {
+			log.Printf("Problem checking snapshot of '%s': %v\n", urlToCheck, err)
+		} else if len(snapshots) > 0 {
+			return &snapshots[0], false
+		}
+		time.Sleep(interval)
+	}
+	return nil, false
+}
+
+// poll the snapshot list in background until archivebox has created the snapshot of the url,
+// existingSnapshots are the ones of the url before the submission, see snapshotsBeforeSubmission
+func trackSubmission(urlToCheck string, existingSnapshots []archivebox.Snapshot,
+	onConfirmed func(snapshot *archivebox.Snapshot, isAlreadyArchived bool), onTimeout func()) {
+	session := primarySession()
+	if session.isAnonymous() {
+		log.Printf("Snapshot of '%s' cannot be confirmed without login\n", urlToCheck)
+		onTimeout()
+		return
+	}
+	runningConfirmations.Add(1)
+	go func() {
+		defer runningConfirmations.Done()
+		snapshot, isAlreadyArchived := waitForSnapshot(urlToCheck, existingSnapshots, session.findSnapshots,
+			confirmationPollInterval, confirmationTimeout)
+		if snapshot == nil {
+			log.Printf("Snapshot of '%s' was not confirmed in time\n", urlToCheck)
+			onTimeout()
+			return
+		}
+		log.Printf("Snapshot %s of '%s' confirmed\n", snapshot.ID, urlToCheck)
+		onConfirmed(snapshot, isAlreadyArchived)
+	}()
+}
+
+// track the submission and inform the user by notification and info label
+func confirmSubmission(urlToCheck string, existingSnapshots []archivebox.Snapshot) {
+	trackSubmission(urlToCheck, existingSnapshots, func(snapshot *archivebox.Snapshot, isAlreadyArchived bool) {
+		messageKey := "URLHasBeenConfirmed"
+		if isAlreadyArchived {
+			messageKey = "URLWasAlreadyArchived"
+		}
+		message := tWithArgs(messageKey, struct {
+			URL  string
+			ID   string
+			Time string
+		}{URL: urlToCheck, ID: snapshot.ID, Time: formatSnapshotTime(snapshot)})
+		fyneApplication.SendNotification(&fyne.Notification{
+			Title: tWithArgs("NotificationTitle", struct {
+				APP_NAME string
+			}{APP_NAME: appConfig.AppName}),
+			Content: message,
+		})
+		fyne.Do(func() {
+			infoLabel.SetText(message)
+		})
+	}, func() {
+		message := tWithArgs("URLNotConfirmed", struct {
+			URL string
+		}{URL: urlToCheck})
+		fyneApplication.SendNotification(&fyne.Notification{
+			Title: tWithArgs("NotificationTitle", struct {
+				APP_NAME string
+			}{APP_NAME: appConfig.AppName}),
+			Content: message,
+		})
+		fyne.Do(func() {
+			infoLabel.SetText(message)
+		})
+	})
+}
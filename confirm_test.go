@@ -0,0 +1,66 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+func TestWaitForSnapshot(t *testing.T) {
+	snapshot := archivebox.Snapshot{ID: "01J0", Timestamp: "1700000005.1", URL: "https://example.org/"}
+	polls := 0
+	findSnapshots := func(u string) ([]archivebox.Snapshot, error) {
+		polls++
+		switch polls {
+		case 1:
+			return nil, errors.New("connection refused")
+		case 2:
+			// archivebox has not created the snapshot yet
+			return nil, nil
+		default:
+			return []archivebox.Snapshot{snapshot}, nil
+		}
+	}
+	confirmed, isAlreadyArchived := waitForSnapshot("https://example.org/", nil, findSnapshots, time.Millisecond, time.Second)
+	if confirmed == nil || confirmed.ID != "01J0" || isAlreadyArchived || polls != 3 {
+		t.Errorf("Expected new snapshot after 3 polls, got %v, %v after %d", confirmed, isAlreadyArchived, polls)
+	}
+
+	findNoSnapshot := func(u string) ([]archivebox.Snapshot, error) {
+		return nil, nil
+	}
+	if confirmed, _ = waitForSnapshot("https://example.org/", nil, findNoSnapshot, time.Millisecond, 20*time.Millisecond); confirmed != nil {
+		t.Errorf("Expected no confirmation, got %v", confirmed)
+	}
+}
+
+// a url archived before gets no new snapshot, its existing one is reported without polling
+func TestWaitForSnapshotOfArchivedURL(t *testing.T) {
+	existing := []archivebox.Snapshot{{ID: "01J0", Timestamp: "1600000000.1", URL: "https://example.org/"}}
+	findSnapshots := func(u string) ([]archivebox.Snapshot, error) {
+		t.Error("Expected no polling")
+		return nil, nil
+	}
+	confirmed, isAlreadyArchived := waitForSnapshot("https://example.org/", existing, findSnapshots, time.Millisecond, time.Second)
+	if confirmed == nil || confirmed.ID != "01J0" || !isAlreadyArchived {
+		t.Errorf("Expected existing snapshot, got %v, %v", confirmed, isAlreadyArchived)
+	}
+}
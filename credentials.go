@@ -0,0 +1,377 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// kinds of credential stores selectable in the settings
+const (
+	credentialStoreAuto          = ""               // secret service if available, encrypted file with key file otherwise
+	credentialStoreSecretService = "secret-service" // keyring of the desktop via d-bus
+	credentialStoreKeyFile       = "key-file"       // encrypted file, the key is derived from a key file
+	credentialStorePassphrase    = "passphrase"     // encrypted file, the key is derived from a master passphrase
+)
+
+// environment variable with the master passphrase, e.g. for the command line
+const passphraseEnvVariable = "ARCHIVEBOX_QUICK_ADD_PASSPHRASE"
+
+// errCredentialsLocked the master passphrase has not been entered yet
+var errCredentialsLocked = errors.New("credential store is locked")
+
+// errCredentialStoreUnavailable the configured credential store cannot be opened, e.g. without d-bus session
+var errCredentialStoreUnavailable = errors.New("credential store is not available")
+
+// credentialStore keeps passwords and api keys outside the preferences
+type credentialStore interface {
+	get(key string) (string, error)
+	set(key string, secret string) error
+	delete(key string) error
+	// keys of all stored secrets
+	keys() ([]string, error)
+}
+
+// store of the passwords and api keys of the profiles, in memory until the app is initialized
+var credentials credentialStore = newMemoryCredentialStore()
+
+// set if a secret could not be read, the secrets of the profiles are incomplete and must not be pruned then
+var isCredentialReadFailed atomicBool
+
+type memoryCredentialStore struct {
+	mutex   sync.Mutex
+	secrets map[string]string
+}
+
+func newMemoryCredentialStore() *memoryCredentialStore {
+	return &memoryCredentialStore{secrets: map[string]string{}}
+}
+
+func (s *memoryCredentialStore) get(key string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.secrets[key], nil
+}
+
+func (s *memoryCredentialStore) set(key string, secret string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.secrets[key] = secret
+	return nil
+}
+
+func (s *memoryCredentialStore) delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.secrets, key)
+	return nil
+}
+
+func (s *memoryCredentialStore) keys() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]string, 0, len(s.secrets))
+	for key := range s.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// unavailableCredentialStore replaces a store which cannot be opened, the secrets stay in the preferences then
+type unavailableCredentialStore struct {
+	err error
+}
+
+func (s *unavailableCredentialStore) get(string) (string, error) { return "", s.err }
+func (s *unavailableCredentialStore) set(string, string) error   { return s.err }
+func (s *unavailableCredentialStore) delete(string) error        { return s.err }
+func (s *unavailableCredentialStore) keys() ([]string, error)    { return nil, s.err }
+
+// secrets belong to the instance url and the user, so profiles can be renamed without losing them
+func passwordKey(target instanceTarget) string {
+	return "password:" + target.Username + "@" + strings.TrimRight(target.InstanceURL, "/")
+}
+
+func apiKeyKey(target instanceTarget) string {
+	return "api_key:" + strings.TrimRight(target.InstanceURL, "/")
+}
+
+func proxyPasswordKey(target instanceTarget) string {
+	return "proxy_password:" + target.Proxy.Username + "@" + target.Proxy.URL
+}
+
+func proxyAuthPasswordKey(target instanceTarget) string {
+	return "proxy_auth_password:" + target.ProxyAuth.Username + "@" + strings.TrimRight(target.InstanceURL, "/")
+}
+
+func proxyAuthTokenKey(target instanceTarget) string {
+	return "proxy_auth_token:" + strings.TrimRight(target.InstanceURL, "/")
+}
+
+// secret of a target with its key in the credential store
+type secretField struct {
+	key   string
+	name  string
+	value *string
+}
+
+// the secrets of the target which are kept in the credential store, unused ones are not looked up
+func (t *instanceTarget) secrets() []secretField {
+	fields := []secretField{
+		{passwordKey(*t), "password", &t.Password},
+		{apiKeyKey(*t), "api key", &t.APIKey},
+	}
+	if len(t.Proxy.Username) > 0 {
+		fields = append(fields, secretField{proxyPasswordKey(*t), "proxy password", &t.Proxy.Password})
+	}
+	switch t.ProxyAuth.Mode {
+	case archivebox.ProxyAuthBasic:
+		fields = append(fields, secretField{proxyAuthPasswordKey(*t), "proxy auth password", &t.ProxyAuth.Password})
+	case archivebox.ProxyAuthBearer:
+		fields = append(fields, secretField{proxyAuthTokenKey(*t), "proxy auth token", &t.ProxyAuth.Token})
+	}
+	return fields
+}
+
+func (t *instanceTarget) clearSecrets() {
+	for _, field := range t.secrets() {
+		*field.value = ""
+	}
+}
+
+func credentialStoreKind() string {
+	return fyneApplication.Preferences().StringWithFallback(preferenceCredentialStore, credentialStoreAuto)
+}
+
+// path of the key file of the encrypted credential file, a generated one in the storage root by default
+func credentialKeyFilePath() string {
+	keyFilePath := fyneApplication.Preferences().StringWithFallback(preferenceCredentialKeyFile, "")
+	if len(keyFilePath) == 0 {
+		keyFilePath = filepath.Join(fyneApplication.Storage().RootURI().Path(), credentialKeyFileName)
+	}
+	return keyFilePath
+}
+
+func credentialFilePath(kind string) string {
+	storageRoot := fyneApplication.Storage().RootURI().Path()
+	if kind == credentialStorePassphrase {
+		return filepath.Join(storageRoot, passphraseCredentialFileName)
+	}
+	return filepath.Join(storageRoot, credentialFileName)
+}
+
+// key of the encrypted credential file, the passphrase of the environment is used if passphrase is empty
+func credentialKeyMaterial(kind string, keyFilePath string, passphrase string) ([]byte, error) {
+	if kind != credentialStorePassphrase {
+		return readOrCreateKeyFile(keyFilePath)
+	}
+	if len(passphrase) == 0 {
+		passphrase = os.Getenv(passphraseEnvVariable)
+	}
+	if len(passphrase) == 0 {
+		return nil, errCredentialsLocked
+	}
+	return []byte(passphrase), nil
+}
+
+// credential store of the kind, an encrypted file stays locked if there is no passphrase yet
+func openCredentialStore(kind string, keyFilePath string, passphrase string) (credentialStore, error) {
+	if kind == credentialStoreSecretService || kind == credentialStoreAuto {
+		store, err := openSecretServiceStore()
+		if err == nil || kind == credentialStoreSecretService {
+			return store, err
+		}
+		log.Printf("Secret service is not available, using an encrypted file for credentials: %v\n", err)
+		kind = credentialStoreKeyFile
+	}
+	store := newEncryptedCredentialStore(credentialFilePath(kind))
+	keyMaterial, err := credentialKeyMaterial(kind, keyFilePath, passphrase)
+	if errors.Is(err, errCredentialsLocked) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, store.unlock(keyMaterial)
+}
+
+// open the configured credential store, nothing is stored if it cannot be opened, see credentialStoreProblem
+func initCredentialStore() {
+	store, err := openCredentialStore(credentialStoreKind(), credentialKeyFilePath(), "")
+	if store == nil {
+		log.Printf("Problem opening credential store: %v\n", err)
+		credentials = &unavailableCredentialStore{err: fmt.Errorf("%w: %v", errCredentialStoreUnavailable, err)}
+		return
+	}
+	if err != nil {
+		log.Printf("Problem unlocking credential store: %v\n", err)
+	}
+	credentials = store
+}
+
+// unlock the encrypted credential file with the master passphrase
+func unlockCredentials(passphrase string) error {
+	store, ok := credentials.(*encryptedCredentialStore)
+	if !ok {
+		return nil
+	}
+	return store.unlock([]byte(passphrase))
+}
+
+// use another kind of credential store, the secrets are moved to the new store
+func switchCredentialStore(kind string, keyFilePath string, passphrase string) error {
+	if isCredentialStoreLocked() {
+		return errCredentialsLocked
+	}
+	if kind == credentialStoreAuto {
+		if _, err := openSecretServiceStore(); err != nil {
+			kind = credentialStoreKeyFile
+		}
+	}
+	if current, ok := credentials.(*encryptedCredentialStore); ok && kind != credentialStoreSecretService &&
+		kind != credentialStoreAuto && current.path == credentialFilePath(kind) {
+		// the same file with another key file
+		keyMaterial, err := credentialKeyMaterial(kind, keyFilePath, passphrase)
+		if err != nil {
+			return err
+		}
+		return current.rekey(keyMaterial)
+	}
+	store, err := openCredentialStore(kind, keyFilePath, passphrase)
+	if err != nil {
+		return err
+	}
+	if encryptedStore, ok := store.(*encryptedCredentialStore); ok && encryptedStore.isLocked() {
+		return errCredentialsLocked
+	}
+	// an unavailable store holds nothing, the secrets of the preferences are moved by the next saveProfiles
+	if _, ok := credentials.(*unavailableCredentialStore); !ok {
+		if err = moveCredentials(credentials, store); err != nil {
+			return err
+		}
+	}
+	credentials = store
+	return nil
+}
+
+// true if the master passphrase has to be entered before the credentials can be used
+func isCredentialStoreLocked() bool {
+	store, ok := credentials.(*encryptedCredentialStore)
+	return ok && store.isLocked()
+}
+
+// nil if secrets can be written to the credential store, errCredentialsLocked or errCredentialStoreUnavailable otherwise
+func credentialStoreProblem() error {
+	if isCredentialStoreLocked() {
+		return errCredentialsLocked
+	}
+	if store, ok := credentials.(*unavailableCredentialStore); ok {
+		return store.err
+	}
+	return nil
+}
+
+// move all secrets to another store, e.g. after the kind of store was changed in the settings
+func moveCredentials(from credentialStore, to credentialStore) error {
+	keys, err := from.keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		secret, err := from.get(key)
+		if err != nil {
+			return err
+		}
+		if err = to.set(key, secret); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err = from.delete(key); err != nil {
+			log.Printf("Problem removing moved secret: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// read the secrets of the target from the credential store
+func loadTargetSecrets(target *instanceTarget) {
+	var err error
+	for _, field := range target.secrets() {
+		if len(*field.value) > 0 {
+			continue
+		}
+		*field.value, err = credentials.get(field.key)
+		if err != nil && !errors.Is(err, errCredentialsLocked) && !errors.Is(err, errCredentialStoreUnavailable) {
+			isCredentialReadFailed.setTrue()
+			log.Printf("Problem reading %s of '%s': %v\n", field.name, target.InstanceURL, err)
+		}
+	}
+}
+
+// write the secrets of all profiles to the credential store and drop the secrets no profile refers to anymore,
+// returns false if the secrets could not be stored and have to be kept in the preferences
+func storeProfileSecrets(profiles map[string]instanceProfile) bool {
+	if credentialStoreProblem() != nil {
+		return false
+	}
+	secrets := map[string]string{}
+	for _, profile := range profiles {
+		for _, target := range profile.targets() {
+			for _, field := range target.secrets() {
+				if len(*field.value) > 0 {
+					secrets[field.key] = *field.value
+				}
+			}
+		}
+	}
+	for key, secret := range secrets {
+		if stored, err := credentials.get(key); err == nil && stored == secret {
+			continue
+		}
+		if err := credentials.set(key, secret); err != nil {
+			log.Printf("Problem storing credentials: %v\n", err)
+			return false
+		}
+	}
+	if isCredentialReadFailed.isSet() {
+		return true
+	}
+	keys, err := credentials.keys()
+	if err != nil {
+		log.Printf("Problem listing credentials: %v\n", err)
+		return true
+	}
+	for _, key := range keys {
+		if _, ok := secrets[key]; !ok {
+			if err = credentials.delete(key); err != nil {
+				log.Printf("Problem removing credentials: %v\n", err)
+			}
+		}
+	}
+	return true
+}
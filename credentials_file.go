@@ -0,0 +1,243 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	credentialFileName           = "credentials.enc"            // encrypted with the key file
+	passphraseCredentialFileName = "credentials-passphrase.enc" // encrypted with the master passphrase
+	credentialKeyFileName        = "credentials.key"
+
+	credentialFileVersion   = 1
+	credentialKeyIterations = 600000
+	credentialKeyLength     = 32 // aes-256
+)
+
+// errWrongPassphrase the credential file cannot be decrypted with the passphrase or key file
+var errWrongPassphrase = errors.New("wrong passphrase or key file")
+
+// content of the credential file, the secrets are encrypted with aes-gcm
+type encryptedCredentialFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// encryptedCredentialStore secrets in a file encrypted with a key derived from a passphrase or key file,
+// locked until unlock is called
+type encryptedCredentialStore struct {
+	mutex   sync.Mutex
+	path    string
+	key     []byte
+	salt    []byte
+	secrets map[string]string
+}
+
+func newEncryptedCredentialStore(path string) *encryptedCredentialStore {
+	return &encryptedCredentialStore{path: path}
+}
+
+// content of the key file, a random key file is generated if there is none yet.
+// By default it is stored in the app storage next to the encrypted file, which hides the secrets from a casual look
+// but does not protect them against anyone who can read the storage.
+func readOrCreateKeyFile(keyFilePath string) ([]byte, error) {
+	keyMaterial, err := os.ReadFile(keyFilePath)
+	if !os.IsNotExist(err) {
+		return keyMaterial, err
+	}
+	keyMaterial = make([]byte, credentialKeyLength)
+	if _, err = rand.Read(keyMaterial); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(keyFilePath), 0700); err != nil {
+		return nil, err
+	}
+	return keyMaterial, os.WriteFile(keyFilePath, keyMaterial, 0600)
+}
+
+func deriveCredentialKey(secret []byte, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, string(secret), salt, credentialKeyIterations, credentialKeyLength)
+}
+
+// decrypt the credential file, a new file is created for the passphrase if there is none yet
+func (s *encryptedCredentialStore) unlock(secret []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.salt = make([]byte, 16)
+		if _, err = rand.Read(s.salt); err != nil {
+			return err
+		}
+		if s.key, err = deriveCredentialKey(secret, s.salt); err != nil {
+			return err
+		}
+		s.secrets = map[string]string{}
+		return s.save()
+	}
+	if err != nil {
+		return err
+	}
+	var file encryptedCredentialFile
+	if err = json.Unmarshal(content, &file); err != nil {
+		return err
+	}
+	key, err := deriveCredentialKey(secret, file.Salt)
+	if err != nil {
+		return err
+	}
+	aead, err := newCredentialCipher(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return errWrongPassphrase
+	}
+	secrets := map[string]string{}
+	if err = json.Unmarshal(plaintext, &secrets); err != nil {
+		return err
+	}
+	s.key, s.salt, s.secrets = key, file.Salt, secrets
+	return nil
+}
+
+// encrypt the secrets with another passphrase or key file
+func (s *encryptedCredentialStore) rekey(secret []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.key == nil {
+		return errCredentialsLocked
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := deriveCredentialKey(secret, salt)
+	if err != nil {
+		return err
+	}
+	s.key, s.salt = key, salt
+	return s.save()
+}
+
+func (s *encryptedCredentialStore) isLocked() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.key == nil
+}
+
+func newCredentialCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// must be called with locked mutex, a new nonce is used for every write
+func (s *encryptedCredentialStore) save() error {
+	plaintext, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	aead, err := newCredentialCipher(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	content, err := json.Marshal(encryptedCredentialFile{
+		Version:    credentialFileVersion,
+		Salt:       s.salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *encryptedCredentialStore) get(key string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.key == nil {
+		return "", errCredentialsLocked
+	}
+	return s.secrets[key], nil
+}
+
+func (s *encryptedCredentialStore) set(key string, secret string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.key == nil {
+		return errCredentialsLocked
+	}
+	s.secrets[key] = secret
+	return s.save()
+}
+
+func (s *encryptedCredentialStore) delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.key == nil {
+		return errCredentialsLocked
+	}
+	if _, ok := s.secrets[key]; !ok {
+		return nil
+	}
+	delete(s.secrets, key)
+	return s.save()
+}
+
+func (s *encryptedCredentialStore) keys() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.key == nil {
+		return nil, errCredentialsLocked
+	}
+	keys := make([]string, 0, len(s.secrets))
+	for key := range s.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,143 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+func TestEncryptedCredentialStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), credentialFileName)
+	store := newEncryptedCredentialStore(path)
+	if _, err := store.get("key"); !errors.Is(err, errCredentialsLocked) {
+		t.Errorf("Expected locked store, got %v", err)
+	}
+	if err := store.unlock([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.set("key", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newEncryptedCredentialStore(path)
+	if err := reopened.unlock([]byte("wrong")); !errors.Is(err, errWrongPassphrase) || !reopened.isLocked() {
+		t.Errorf("Expected wrong passphrase, got %v", err)
+	}
+	if err := reopened.unlock([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := reopened.get("key"); err != nil || secret != "secret" {
+		t.Errorf("Expected stored secret, got %q, %v", secret, err)
+	}
+
+	if err := reopened.rekey([]byte("new passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	rekeyed := newEncryptedCredentialStore(path)
+	if err := rekeyed.unlock([]byte("new passphrase")); err != nil {
+		t.Errorf("Expected the new passphrase to unlock the store, got %v", err)
+	}
+}
+
+func TestPlaintextSecretsAreMigrated(t *testing.T) {
+	fyneApplication = test.NewApp()
+	credentials = newMemoryCredentialStore()
+	legacyProfiles := map[string]instanceProfile{defaultProfileName: {
+		instanceTarget: instanceTarget{InstanceURL: "http://127.0.0.1:8000", Username: "admin", Password: "secret",
+			Proxy: proxySettings{Mode: proxyModeCustom, URL: "socks5://127.0.0.1:1080", Username: "proxy", Password: "tunnel"}},
+		Mirrors: []instanceTarget{{InstanceURL: "https://mirror.example.org", APIKey: "key",
+			ProxyAuth: proxyAuthSettings{Mode: archivebox.ProxyAuthBearer, Token: "opaque"}}},
+	}}
+	legacyJSON, _ := json.Marshal(legacyProfiles)
+	fyneApplication.Preferences().SetString(preferenceProfiles, string(legacyJSON))
+
+	profile := loadProfiles()[defaultProfileName]
+	if profile.Password != "secret" || profile.Mirrors[0].APIKey != "key" || profile.Proxy.Password != "tunnel" ||
+		profile.Mirrors[0].ProxyAuth.Token != "opaque" {
+		t.Errorf("Expected secrets of the profile, got %v", profile)
+	}
+	profilesJSON := fyneApplication.Preferences().String(preferenceProfiles)
+	if strings.Contains(profilesJSON, "secret") || strings.Contains(profilesJSON, `"key"`) || strings.Contains(profilesJSON, "tunnel") ||
+		strings.Contains(profilesJSON, "opaque") {
+		t.Errorf("Expected no secrets in the preferences, got %s", profilesJSON)
+	}
+	if secret, _ := credentials.get(passwordKey(profile.instanceTarget)); secret != "secret" {
+		t.Errorf("Expected password in the credential store, got %q", secret)
+	}
+
+	// secrets of removed mirrors are dropped
+	updateCurrentProfile(func(profile *instanceProfile) {
+		profile.Mirrors = nil
+	})
+	if keys, _ := credentials.keys(); len(keys) != 2 {
+		t.Errorf("Expected only the passwords of the instance and the proxy to be kept, got %v", keys)
+	}
+
+	// the secrets stay in the preferences as long as the store is locked
+	credentials = newEncryptedCredentialStore(filepath.Join(t.TempDir(), passphraseCredentialFileName))
+	defer func() {
+		credentials = newMemoryCredentialStore()
+	}()
+	saveProfiles(legacyProfiles)
+	if !strings.Contains(fyneApplication.Preferences().String(preferenceProfiles), "secret") {
+		t.Errorf("Expected secrets to be kept while the store is locked")
+	}
+	// loading the profiles does not write them again while the store is locked
+	indentedJSON, _ := json.MarshalIndent(legacyProfiles, "", "  ")
+	fyneApplication.Preferences().SetString(preferenceProfiles, string(indentedJSON))
+	if loadProfiles()[defaultProfileName].Password != "secret" ||
+		fyneApplication.Preferences().String(preferenceProfiles) != string(indentedJSON) {
+		t.Errorf("Expected unchanged profiles while the store is locked")
+	}
+}
+
+func TestSecretsAreKeptWithoutCredentialStore(t *testing.T) {
+	fyneApplication = test.NewApp()
+	defer func() {
+		credentials = newMemoryCredentialStore()
+	}()
+	// the key file cannot be read
+	fyneApplication.Preferences().SetString(preferenceCredentialStore, credentialStoreKeyFile)
+	fyneApplication.Preferences().SetString(preferenceCredentialKeyFile, t.TempDir())
+	fyneApplication.Preferences().SetString(preferenceUsername, "admin")
+	fyneApplication.Preferences().SetString(preferencePassword, "secret")
+	initCredentialStore()
+	if err := credentialStoreProblem(); !errors.Is(err, errCredentialStoreUnavailable) {
+		t.Fatalf("Expected unavailable credential store, got %v", err)
+	}
+
+	if profile := loadProfiles()[defaultProfileName]; profile.Password != "secret" {
+		t.Errorf("Expected migrated password, got %v", profile)
+	}
+	if !strings.Contains(fyneApplication.Preferences().String(preferenceProfiles), "secret") {
+		t.Errorf("Expected the password to be kept in the preferences")
+	}
+	// the next start of the app still has the password
+	credentials = newMemoryCredentialStore()
+	initCredentialStore()
+	if profile := loadProfiles()[defaultProfileName]; profile.Password != "secret" {
+		t.Errorf("Expected the password after a restart, got %v", profile)
+	}
+}
@@ -0,0 +1,152 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// upper limit of all steps of the diagnosis
+const diagnosticsTimeout = 30 * time.Second
+
+// step of invalid tls or proxy settings, they are checked before the connection steps
+const diagnosticStepSettings = "settings"
+
+// runs the steps of the connection setup to the url of the target one by one
+func diagnoseConnection(target instanceTarget, endpoint string) []archivebox.DiagnosticStep {
+	start := time.Now()
+	transport, err := newInstanceTransport(target)
+	if err != nil {
+		return []archivebox.DiagnosticStep{{Name: diagnosticStepSettings, Duration: time.Since(start), Err: err}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+	return archivebox.Diagnose(ctx, archivebox.Config{
+		InstanceURL: endpoint,
+		Username:    target.Username,
+		Password:    target.Password,
+		Transport:   transport,
+		ProxyAuth:   target.ProxyAuth.options(),
+	})
+}
+
+var diagnosticStepLabels = map[string]string{
+	diagnosticStepSettings:    "DiagnosticSettings",
+	archivebox.StepParseURL:   "DiagnosticURL",
+	archivebox.StepDNS:        "DiagnosticDNS",
+	archivebox.StepTCP:        "DiagnosticTCP",
+	archivebox.StepTLS:        "DiagnosticTLS",
+	archivebox.StepLoginPage:  "DiagnosticLoginPage",
+	archivebox.StepCSRFCookie: "DiagnosticCSRFCookie",
+	archivebox.StepCSRFToken:  "DiagnosticCSRFToken",
+	archivebox.StepLogin:      "DiagnosticLogin",
+	archivebox.StepSessionID:  "DiagnosticSessionID",
+}
+
+func diagnosticStepLabel(name string) string {
+	if key, ok := diagnosticStepLabels[name]; ok {
+		return t(key)
+	}
+	return name
+}
+
+// what the user can check if the step failed, empty for passed and skipped steps
+func diagnosticHint(step archivebox.DiagnosticStep) string {
+	if step.Err == nil {
+		return ""
+	}
+	var statusErr *archivebox.StatusError
+	var authErr *archivebox.AuthenticationError
+	switch step.Name {
+	case diagnosticStepSettings:
+		return t("HintSettings")
+	case archivebox.StepParseURL:
+		return t("HintURL")
+	case archivebox.StepDNS:
+		return t("HintDNS")
+	case archivebox.StepTCP:
+		return t("HintTCP")
+	case archivebox.StepTLS:
+		return t("HintTLS")
+	case archivebox.StepLoginPage:
+		if errors.As(step.Err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return t("HintLoginPageNotFound")
+		}
+		return t("HintLoginPage")
+	case archivebox.StepCSRFCookie, archivebox.StepCSRFToken:
+		return t("HintCSRF")
+	case archivebox.StepLogin:
+		if errors.As(step.Err, &authErr) {
+			return t("HintLoginRejected")
+		}
+		return t("HintLogin")
+	case archivebox.StepSessionID:
+		return t("HintSessionID")
+	default:
+		return ""
+	}
+}
+
+func diagnosticStatus(step archivebox.DiagnosticStep) string {
+	switch {
+	case step.Skipped:
+		return "SKIP"
+	case step.Err != nil:
+		return "FAIL"
+	default:
+		return "PASS"
+	}
+}
+
+// plain text report of the diagnosis for bug tickets, the secrets of the target are left out
+func diagnosticsReport(target instanceTarget, endpoint string, steps []archivebox.DiagnosticStep) string {
+	var report strings.Builder
+	fmt.Fprintf(&report, "%s %s (%s/%s, %s)\n", appConfig.AppName, appConfig.AppVersion, runtime.GOOS, runtime.GOARCH, runtime.Version())
+	fmt.Fprintf(&report, "Date: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&report, "Instance: %s\n", endpoint)
+	proxyMode := target.Proxy.Mode
+	if len(proxyMode) == 0 {
+		proxyMode = "system"
+	}
+	proxyAuthMode := string(target.ProxyAuth.Mode)
+	if len(proxyAuthMode) == 0 {
+		proxyAuthMode = "none"
+	}
+	fmt.Fprintf(&report, "Username: %t, password: %t, api key: %t, proxy: %s, proxy auth: %s, custom ca: %t, "+
+		"client certificate: %t, pinned keys: %d, insecure: %t\n\n",
+		len(target.Username) > 0, len(target.Password) > 0, len(target.APIKey) > 0, proxyMode, proxyAuthMode,
+		len(target.TLS.CAFile) > 0, len(target.TLS.CertFile) > 0, len(target.TLS.PinnedKeys), target.TLS.Insecure)
+	for _, step := range steps {
+		line := fmt.Sprintf("%s %-20s %8s", diagnosticStatus(step), step.Name, step.Duration.Round(time.Millisecond))
+		if len(step.Detail) > 0 {
+			line += " " + step.Detail
+		}
+		if step.Err != nil {
+			line += " error: " + step.Err.Error()
+		}
+		report.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return report.String()
+}
@@ -0,0 +1,56 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+func TestDiagnosticsReport(t *testing.T) {
+	fyneApplication = test.NewApp()
+	appConfig.initI18n()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	target := instanceTarget{InstanceURL: server.URL, Username: "admin", Password: "secret", APIKey: "key"}
+
+	steps := diagnoseConnection(target, server.URL)
+	failed := steps[4]
+	if failed.Name != archivebox.StepLoginPage || failed.Err == nil || len(diagnosticHint(failed)) == 0 {
+		t.Errorf("Expected missing login page with hint, got %v", failed)
+	}
+	report := diagnosticsReport(target, server.URL, steps)
+	if !strings.Contains(report, "FAIL login-page") || !strings.Contains(report, "SKIP sessionid") {
+		t.Errorf("Expected status of each step, got %s", report)
+	}
+	if strings.Contains(report, "secret") || !strings.Contains(report, "api key: true") {
+		t.Errorf("Expected no secrets in the report, got %s", report)
+	}
+
+	target.TLS.CAFile = "/missing/ca.pem"
+	if steps = diagnoseConnection(target, server.URL); len(steps) != 1 || steps[0].Name != diagnosticStepSettings {
+		t.Errorf("Expected invalid settings, got %v", steps)
+	}
+}
@@ -0,0 +1,215 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// time to wait for an answer of a candidate url of an instance
+const probeTimeout = 2 * time.Second
+
+var endpointCacheMutex sync.Mutex
+
+// candidate urls of the instance in order of preference
+func (t instanceTarget) candidateURLs() []string {
+	return append([]string{t.InstanceURL}, t.AlternativeURLs...)
+}
+
+// normalized url of an instance, the trimmed input if it is no valid url
+func normalizeInstanceURL(rawURL string) string {
+	normalizedURL, err := archivebox.NormalizeURL(rawURL)
+	if err != nil {
+		return strings.TrimSpace(rawURL)
+	}
+	return normalizedURL
+}
+
+// alternative urls entered one per line, normalized and without duplicates
+func parseAlternativeURLs(text string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(text, "\n") {
+		alternativeURL := normalizeInstanceURL(line)
+		if len(alternativeURL) == 0 || seen[alternativeURL] {
+			continue
+		}
+		seen[alternativeURL] = true
+		urls = append(urls, alternativeURL)
+	}
+	return urls
+}
+
+// identifies the network the computer is connected to by the subnets of its interfaces,
+// so e.g. the lan url of an instance is remembered at home and the public url elsewhere
+func currentNetworkID() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		log.Printf("Problem reading network interfaces: %v\n", err)
+		return ""
+	}
+	var subnets []string
+	for _, networkInterface := range interfaces {
+		if networkInterface.Flags&net.FlagUp == 0 || networkInterface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addresses, err := networkInterface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			ipNet, ok := address.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			subnets = append(subnets, (&net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask}).String())
+		}
+	}
+	sort.Strings(subnets)
+	return strings.Join(subnets, ",")
+}
+
+func endpointCacheKey(target instanceTarget) string {
+	return currentNetworkID() + " " + target.InstanceURL
+}
+
+func loadEndpointCache() map[string]string {
+	cache := map[string]string{}
+	cacheJSON := fyneApplication.Preferences().StringWithFallback(preferenceEndpoints, "")
+	if len(cacheJSON) > 0 {
+		if err := json.Unmarshal([]byte(cacheJSON), &cache); err != nil {
+			log.Printf("Problem reading cached instance endpoints: %v\n", err)
+		}
+	}
+	return cache
+}
+
+func saveEndpointCache(cache map[string]string) {
+	cacheJSON, err := json.Marshal(cache)
+	if err != nil {
+		log.Printf("Problem saving cached instance endpoints: %v\n", err)
+		return
+	}
+	fyneApplication.Preferences().SetString(preferenceEndpoints, string(cacheJSON))
+}
+
+// the endpoint used for the instance in the current network, if there is one
+func cachedEndpoint(target instanceTarget) (string, bool) {
+	endpointCacheMutex.Lock()
+	defer endpointCacheMutex.Unlock()
+	endpoint, ok := loadEndpointCache()[endpointCacheKey(target)]
+	if !ok {
+		return "", false
+	}
+	// ignore urls which were removed from the profile in the meantime
+	for _, candidate := range target.candidateURLs() {
+		if candidate == endpoint {
+			return endpoint, true
+		}
+	}
+	return "", false
+}
+
+func storeEndpoint(target instanceTarget, endpoint string) {
+	endpointCacheMutex.Lock()
+	defer endpointCacheMutex.Unlock()
+	cache := loadEndpointCache()
+	cache[endpointCacheKey(target)] = endpoint
+	saveEndpointCache(cache)
+}
+
+// the next connection setup probes the candidate urls of the instance again
+func forgetEndpoint(target instanceTarget) {
+	endpointCacheMutex.Lock()
+	defer endpointCacheMutex.Unlock()
+	cache := loadEndpointCache()
+	delete(cache, endpointCacheKey(target))
+	saveEndpointCache(cache)
+}
+
+func probeEndpoint(target instanceTarget, endpoint string) error {
+	transport, err := newInstanceTransport(target)
+	if err != nil {
+		return err
+	}
+	client, err := archivebox.NewClient(archivebox.Config{InstanceURL: endpoint, Transport: transport})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	return client.Ping(ctx)
+}
+
+// checks that archivebox answers at the instance url with the connection settings of the target
+func probeInstance(target instanceTarget) error {
+	transport, err := newInstanceTransport(target)
+	if err != nil {
+		return err
+	}
+	client, err := archivebox.NewClient(archivebox.Config{
+		InstanceURL: target.InstanceURL,
+		Transport:   transport,
+		ProxyAuth:   target.ProxyAuth.options(),
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return client.Probe(ctx)
+}
+
+// url to connect to the instance with: the cached choice of the current network or
+// the first reachable candidate, the instance url if no candidate answers
+func selectEndpoint(target instanceTarget) string {
+	if len(target.AlternativeURLs) == 0 {
+		return target.InstanceURL
+	}
+	if endpoint, ok := cachedEndpoint(target); ok {
+		return endpoint
+	}
+	candidates := target.candidateURLs()
+	probeErrors := make([]error, len(candidates))
+	var waitGroup sync.WaitGroup
+	for i, candidate := range candidates {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			probeErrors[i] = probeEndpoint(target, candidate)
+		}()
+	}
+	waitGroup.Wait()
+	for i, candidate := range candidates {
+		if probeErrors[i] == nil {
+			log.Printf("Using '%s' to connect to '%s'\n", candidate, target.InstanceURL)
+			storeEndpoint(target, candidate)
+			return candidate
+		}
+		log.Printf("Instance url '%s' is not reachable: %v\n", candidate, probeErrors[i])
+	}
+	return target.InstanceURL
+}
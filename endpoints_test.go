@@ -0,0 +1,71 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestParseAlternativeURLs(t *testing.T) {
+	urls := parseAlternativeURLs(" http://192.168.1.2:8000/ \n\nhttps://archive.example.org\nhttp://192.168.1.2:8000\n" +
+		"https://Archive.example.org:443/\nhttps://tools.example.org/archivebox/\n")
+	expected := []string{"http://192.168.1.2:8000", "https://archive.example.org", "https://tools.example.org/archivebox"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected %v, got %v", expected, urls)
+	}
+}
+
+func TestConnectWithAlternativeURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/auth/check_api_token" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+		}
+	}))
+	defer server.Close()
+	offline := httptest.NewServer(http.NotFoundHandler())
+	offline.Close()
+
+	fyneApplication = test.NewApp()
+	appConfig.initI18n()
+	target := instanceTarget{InstanceURL: offline.URL, APIKey: "secret", AlternativeURLs: []string{server.URL}}
+	saveProfiles(map[string]instanceProfile{defaultProfileName: {instanceTarget: target}})
+	if err := activateProfile(defaultProfileName); err != nil {
+		t.Fatal(err)
+	}
+
+	if primarySession().endpoint() != offline.URL {
+		t.Errorf("Expected the instance url before the connection setup")
+	}
+	if err := setupArchiveBoxConnection(); err != nil {
+		t.Fatalf("Expected connection via the alternative url, got %v", err)
+	}
+	if endpoint := primarySession().endpoint(); endpoint != server.URL {
+		t.Errorf("Expected endpoint %s, got %s", server.URL, endpoint)
+	}
+	if endpoint, ok := cachedEndpoint(target); !ok || endpoint != server.URL {
+		t.Errorf("Expected the choice to be cached, got %q", endpoint)
+	}
+	forgetEndpoint(target)
+	if _, ok := cachedEndpoint(target); ok {
+		t.Errorf("Expected no cached endpoint")
+	}
+}
@@ -18,11 +18,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"image/color"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -41,23 +41,22 @@ import (
 	"golang.org/x/text/language"
 )
 
-// default http client
-var httpClient = &http.Client{
-	Timeout: 10 * time.Second,
-}
-
-var archiveSearchHTTPClient = &http.Client{
-	Timeout: 30 * time.Second,
-}
-
 var fyneApplication fyne.App
 var window fyne.Window
 var windowSize = fyne.Size{Width: 600, Height: 200}
 
 // widgets
 var inputEntryWidget *URLInputField
+var tagEntryWidget *TagInputField
+var depthRadioGroup *widget.RadioGroup
+var archiveMethodsBtn *widget.Button
+var parserSelect *widget.Select
 var addToArchiveBtn *widget.Button
+var queueBtn *widget.Button
 var infoLabel *widget.Label
+var diagnoseBtn *widget.Button
+var instanceLink *widget.Hyperlink
+var profileSelect *widget.Select
 
 var appConfig applicationConfiguration
 var appSessionState sessionState
@@ -76,51 +75,67 @@ type applicationConfiguration struct {
 
 // store archivebox session state, e.g. cookies
 type sessionState struct {
-	IsConnected         bool
-	CsrfToken           *http.Cookie
-	SessionCookie       *http.Cookie
-	CsrfMiddlewareToken string
-	ConnectionErr       error // store latest error
 	IsSubmissionBlocked atomicBool
 	IsCloseBlocked      atomicBool
+	IsBatchRunning      atomicBool
 }
 
 const (
-	preferenceInstanceURL   = "InstanceURL"   // string
-	preferenceUsername      = "Username"      // string
-	preferencePassword      = "Password"      // string
+	// instance settings of older versions, migrated to the default profile
+	preferenceInstanceURL = "InstanceURL" // string
+	preferenceUsername    = "Username"    // string
+	preferencePassword    = "Password"    // string
+	preferenceAPIKey      = "APIKey"      // string
+
 	preferenceBorderless    = "Borderless"    // bool
 	preferenceCheckAdd      = "CheckAdd"      // bool
 	preferenceCloseAfterAdd = "CloseAfterAdd" // bool
 	preferenceFirstRun      = "FirstRun"      // bool
+
+	preferenceArchiveMethods       = "ArchiveMethods"       // string list, migrated to the default profile
+	preferenceArchiveMethodPresets = "ArchiveMethodPresets" // string, json encoded map of preset name to methods
+	preferenceParser               = "Parser"               // string
+	preferenceMaxRetries           = "MaxRetries"           // int
+	preferenceConfirmSubmission    = "ConfirmSubmission"    // bool
+	preferenceRetryBaseDelay       = "RetryBaseDelay"       // int, seconds
+	preferenceProfiles             = "Profiles"             // string, json object of instance profiles by name
+	preferenceActiveProfile        = "ActiveProfile"        // string
+	preferenceEndpoints            = "Endpoints"            // string, json object of the chosen instance urls by network
+	preferenceStayLoggedIn         = "StayLoggedIn"         // bool
+	preferenceCredentialStore      = "CredentialStore"      // string, kind of the store of passwords and api keys
+	preferenceCredentialKeyFile    = "CredentialKeyFile"    // string, path of the key file of the encrypted credentials
 )
 
 func main() {
-	appConfig = applicationConfiguration{
-		AppID:           "org.archivebox.go-quick-add",
-		AppName:         "ArchiveBox Quick-Add",
-		AppVersion:      "1.10",
-		AppLinkToGitHub: "https://github.com/emschu/archivebox-quick-add",
+	if len(os.Args) > 1 && isCLICommand(os.Args[1]) {
+		// headless usage without a window, e.g. in scripts
+		initApplication()
+		os.Exit(runCLICommand(os.Args[1], os.Args[2:], os.Stdout))
 	}
 
-	appSessionState = sessionState{}
-	appSessionState.IsConnected = false
-	appSessionState.IsSubmissionBlocked = *newAtomicBool(false)
-	appSessionState.IsCloseBlocked = *newAtomicBool(false)
-	appConfig.initI18n()
-
-	fyneApplication = app.NewWithID(appConfig.AppID)
-	fyneApplication.SetIcon(resourceIconPng)
-
-	// load archive box instance url
-	appConfig.InstanceURL = fyneApplication.Preferences().StringWithFallback(preferenceInstanceURL, "http://127.0.0.1:8000")
+	depthFlag := flag.Int("depth", 0, "preselected crawl depth of a submission, 0 or 1")
+	profileFlag := flag.String("profile", "", "name of the instance profile to use")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options]\n       %s add|check|search|login-test [options] ...\n",
+			os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *depthFlag != 0 && *depthFlag != 1 {
+		fmt.Fprintf(os.Stderr, "Invalid depth %d, allowed values are 0 and 1\n", *depthFlag)
+		os.Exit(2)
+	}
 
-	isFirstRun := fyneApplication.Preferences().BoolWithFallback(preferenceFirstRun, true)
-	if isFirstRun {
-		// initial preference setup
-		appConfig.doInitialPreferenceSetup()
+	initApplication()
+	if len(*profileFlag) > 0 {
+		if err := activateProfile(*profileFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 	}
 
+	pendingQueue = loadSubmissionQueue(fyneApplication.Storage().RootURI().Path())
+
 	isSplashScreen := fyneApplication.Preferences().BoolWithFallback(preferenceBorderless, true)
 	drv, ok := fyne.CurrentApp().Driver().(desktop.Driver)
 	if ok && isSplashScreen {
@@ -164,22 +179,60 @@ func main() {
 		Monospace: false,
 	}
 
+	// offered once the connection failed
+	diagnoseBtn = widget.NewButtonWithIcon(t("Diagnose"), theme.SearchIcon(), func() {
+		showDiagnosticsDialog()
+	})
+	diagnoseBtn.Hide()
+
 	defer func() {
 		doArchiveBoxLogout()
 	}()
 
-	parsedURL, err := url.Parse(appConfig.InstanceURL)
-	var instanceLink fyne.Widget
-	if err != nil {
-		log.Printf("No valid url to archivebox instance\n")
-		instanceLink = widget.NewLabel("")
-	} else {
-		instanceLink = widget.NewHyperlink(appConfig.InstanceURL, parsedURL)
-	}
+	instanceLink = widget.NewHyperlink("", nil)
+	updateInstanceLink()
+	profileSelect = newProfileSelect()
 
 	inputEntryWidget = newURLInputField()
+	tagEntryWidget = newTagInputField()
+	tagEntryWidget.SetText(strings.Join(currentProfile().Tags, ", "))
+	depthRadioGroup = newDepthRadioGroup(*depthFlag)
+	archiveMethodsBtn = widget.NewButtonWithIcon(archiveMethodsSummary(selectedArchiveMethods, loadArchiveMethodPresets()),
+		theme.ListIcon(), func() {
+			showArchiveMethodsDialog()
+		})
+	parserSelect = newParserSelect()
 
-	go setupArchiveBoxConnection()
+	queueBtn = widget.NewButtonWithIcon("", theme.HistoryIcon(), func() {
+		showQueueDialog()
+	})
+	pendingQueue.onChange = func() {
+		fyne.Do(updateQueueView)
+	}
+	updateQueueView()
+
+	go func() {
+		if err := credentialStoreProblem(); errors.Is(err, errCredentialStoreUnavailable) {
+			fyne.Do(func() {
+				dialog.ShowError(fmt.Errorf("%s", tWithArgs("CredentialStoreUnavailable", struct {
+					ERROR string
+				}{ERROR: err.Error()})), window)
+			})
+		}
+		if isCredentialStoreLocked() {
+			// the connection is set up once the master passphrase has been entered
+			fyne.Do(func() {
+				showUnlockCredentialsDialog(func() {
+					switchProfile(activeProfileName)
+					pendingQueue.startAutoReplay()
+				})
+			})
+			return
+		}
+		setupArchiveBoxConnection()
+		loadTagSuggestions()
+		pendingQueue.startAutoReplay()
+	}()
 
 	addToArchiveBtn = widget.NewButtonWithIcon(t("AddToArchive"), theme.ContentAddIcon(), func() {})
 	cancelBtn := widget.NewButtonWithIcon(t("Close"), theme.CancelIcon(), func() {
@@ -218,15 +271,20 @@ func main() {
 			layout.NewSpacer(),
 			logoTextItem,
 			layout.NewSpacer(),
+			queueBtn,
 			settingsBtn,
 			infoBtn,
 		),
-		container.NewHBox(
+		container.NewBorder(nil, nil, container.NewHBox(
 			instanceInfoLabel,
 			instanceLink,
-		),
-		infoLabel,
+		), container.NewHBox(widget.NewLabel(t("Profile")), profileSelect)),
+		container.NewBorder(nil, nil, nil, diagnoseBtn, infoLabel),
 		inputEntryWidget,
+		container.NewBorder(nil, nil, widget.NewLabel(t("Tags")),
+			container.NewHBox(widget.NewLabel(t("Depth")), depthRadioGroup), tagEntryWidget),
+		container.NewBorder(nil, nil, widget.NewLabel(t("ArchiveMethods")),
+			container.NewHBox(widget.NewLabel(t("Parser")), parserSelect), archiveMethodsBtn),
 		addToArchiveBtn,
 		clipBoardBtn,
 		cancelBtn,
@@ -245,10 +303,40 @@ func main() {
 	window.ShowAndRun()
 }
 
+// state and preferences shared by the window and the cli commands
+func initApplication() {
+	appConfig = applicationConfiguration{
+		AppID:           "org.archivebox.go-quick-add",
+		AppName:         "ArchiveBox Quick-Add",
+		AppVersion:      "1.10",
+		AppLinkToGitHub: "https://github.com/emschu/archivebox-quick-add",
+	}
+
+	appSessionState = sessionState{}
+	appSessionState.IsSubmissionBlocked = *newAtomicBool(false)
+	appSessionState.IsCloseBlocked = *newAtomicBool(false)
+	appSessionState.IsBatchRunning = *newAtomicBool(false)
+	appConfig.initI18n()
+
+	fyneApplication = app.NewWithID(appConfig.AppID)
+	fyneApplication.SetIcon(resourceIconPng)
+
+	isFirstRun := fyneApplication.Preferences().BoolWithFallback(preferenceFirstRun, true)
+	if isFirstRun {
+		// initial preference setup
+		appConfig.doInitialPreferenceSetup()
+	}
+
+	storedSessions = loadSessionStore(fyneApplication.Storage().RootURI().Path())
+	initCredentialStore()
+
+	// load archive box instance url, credentials and defaults of the last used profile
+	if err := activateProfile(""); err != nil {
+		log.Printf("Problem loading profile: %v\n", err)
+	}
+}
+
 func (*applicationConfiguration) doInitialPreferenceSetup() {
-	fyneApplication.Preferences().SetString(preferenceInstanceURL, "http://127.0.0.1:8000")
-	fyneApplication.Preferences().SetString(preferenceUsername, "")
-	fyneApplication.Preferences().SetString(preferencePassword, "")
 	fyneApplication.Preferences().SetBool(preferenceBorderless, true)
 	fyneApplication.Preferences().SetBool(preferenceCloseAfterAdd, true)
 	fyneApplication.Preferences().SetBool(preferenceCheckAdd, true)
@@ -315,7 +403,7 @@ func (*applicationConfiguration) safeClose() {
 		appSessionState.IsSubmissionBlocked.setTrue()
 		confirmD := dialog.NewConfirm(t("Cancel"), t("DoYouReallyWantToClose"), func(decision bool) {
 			if decision { // = yes
-				fyneApplication.Quit()
+				quitApp()
 			}
 		}, window)
 		confirmD.SetOnClosed(func() {
@@ -325,16 +413,28 @@ func (*applicationConfiguration) safeClose() {
 		confirmD.Show()
 	} else {
 		// close immediately if input is empty
-		fyneApplication.Quit()
+		quitApp()
 	}
 }
 
-func (*applicationConfiguration) disconnect() {
-	appSessionState.IsConnected = false
+// quits the app, running submission confirmations are finished in background with a hidden window
+func quitApp() {
+	fyne.Do(window.Hide)
+	go func() {
+		runningConfirmations.Wait()
+		fyne.Do(fyneApplication.Quit)
+	}()
+}
+
+func (*applicationConfiguration) disconnect(connectionErr error) {
 	log.Printf("Warn: No connection could be established!\n")
+	if infoLabel == nil {
+		// no window in cli mode
+		return
+	}
 	infoLabel.Text = t("NoConnectionPossible")
-	if appSessionState.ConnectionErr != nil {
-		infoLabel.Text += " " + appSessionState.ConnectionErr.Error()
+	if connectionErr != nil {
+		infoLabel.Text += " " + localizeError(connectionErr)
 	}
 	infoLabel.Refresh()
 }
@@ -345,6 +445,9 @@ func (b *atomicBool) isSet() bool { return atomic.LoadInt32((*int32)(b)) != 0 }
 func (b *atomicBool) setTrue()    { atomic.StoreInt32((*int32)(b), 1) }
 func (b *atomicBool) setFalse()   { atomic.StoreInt32((*int32)(b), 0) }
 
+// sets the value to true, false if it was already set
+func (b *atomicBool) trySetTrue() bool { return atomic.CompareAndSwapInt32((*int32)(b), 0, 1) }
+
 func newAtomicBool(startVal bool) *atomicBool {
 	var ab atomicBool
 	if startVal {
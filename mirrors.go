@@ -0,0 +1,127 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// instanceResult outcome of the submission of an url to one instance of the profile
+type instanceResult struct {
+	InstanceURL string
+	HasWorked   bool
+	Err         error
+}
+
+// the instance is not reachable, the url can be queued for it
+func (r instanceResult) isUnreachable() bool {
+	return r.Err != nil && archivebox.IsConnectionError(r.Err)
+}
+
+// send the url to the instance and all mirrors of the active profile in parallel,
+// the first result is the one of the instance followed by the mirrors
+func sendURLToInstances(urlToSave string, options submissionOptions,
+	onRetry func(instanceURL string, attempt int, maxAttempts int, err error)) []instanceResult {
+	sessions := activeSessions()
+	results := make([]instanceResult, len(sessions))
+	var wg sync.WaitGroup
+	for i, session := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instanceURL := session.target.InstanceURL
+			hasWorked, err := sendURLWithRetries(session, urlToSave, options, func(attempt int, maxAttempts int, err error) {
+				if onRetry != nil {
+					onRetry(instanceURL, attempt, maxAttempts, err)
+				}
+			})
+			results[i] = instanceResult{InstanceURL: instanceURL, HasWorked: hasWorked, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// queue the url for each unreachable instance, returns the number of queued submissions
+func queueUnreachableInstances(urlToSave string, options submissionOptions, results []instanceResult) int {
+	if !isURL(urlToSave) {
+		return 0
+	}
+	queued := 0
+	for i, result := range results {
+		if !result.isUnreachable() {
+			continue
+		}
+		instanceURL := result.InstanceURL
+		if i == 0 {
+			// the instance of the profile, even if its url is changed later on
+			instanceURL = ""
+		}
+		pendingQueue.add(urlToSave, options, instanceURL, result.Err)
+		queued++
+	}
+	return queued
+}
+
+// first problem of an instance which is not solved by queueing the url, nil if there is none
+func instanceFailure(results []instanceResult) error {
+	for _, result := range results {
+		if result.isUnreachable() || (result.Err == nil && result.HasWorked) {
+			continue
+		}
+		err := result.Err
+		if err == nil {
+			err = fmt.Errorf("%s", t("UnknownProblemAddingURL"))
+		}
+		if len(results) > 1 {
+			return fmt.Errorf("%s: %s", result.InstanceURL, localizeError(err))
+		}
+		return err
+	}
+	return nil
+}
+
+// one line per instance with the outcome of the submission
+func instanceResultsText(results []instanceResult) string {
+	lines := make([]string, 0, len(results))
+	for _, result := range results {
+		switch {
+		case result.isUnreachable():
+			lines = append(lines, tWithArgs("InstanceURLQueued", struct {
+				URL string
+			}{URL: result.InstanceURL}))
+		case result.Err != nil || !result.HasWorked:
+			message := t("UnknownProblemAddingURL")
+			if result.Err != nil {
+				message = localizeError(result.Err)
+			}
+			lines = append(lines, tWithArgs("InstanceURLFailed", struct {
+				URL   string
+				ERROR string
+			}{URL: result.InstanceURL, ERROR: message}))
+		default:
+			lines = append(lines, tWithArgs("InstanceURLSent", struct {
+				URL string
+			}{URL: result.InstanceURL}))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
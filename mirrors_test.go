@@ -0,0 +1,76 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestSendURLToInstances(t *testing.T) {
+	var added int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/auth/check_api_token":
+			_, _ = w.Write([]byte(`{"success": true}`))
+		case "/api/v1/cli/add":
+			added++
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	offline := httptest.NewServer(http.NotFoundHandler())
+	offline.Close()
+
+	fyneApplication = test.NewApp()
+	appConfig.initI18n()
+	fyneApplication.Preferences().SetInt(preferenceMaxRetries, 0)
+	pendingQueue = loadSubmissionQueue(t.TempDir())
+	saveProfiles(map[string]instanceProfile{defaultProfileName: {
+		instanceTarget: instanceTarget{InstanceURL: server.URL, APIKey: "secret"},
+		Mirrors:        []instanceTarget{{InstanceURL: offline.URL, APIKey: "secret"}},
+	}})
+	if err := activateProfile(defaultProfileName); err != nil {
+		t.Fatal(err)
+	}
+
+	results := sendURLToInstances("https://example.org/", submissionOptions{}, nil)
+	if len(results) != 2 || !results[0].HasWorked || results[0].Err != nil || added != 1 {
+		t.Fatalf("Expected submission to the instance, got %v", results)
+	}
+	if results[1].InstanceURL != offline.URL || !results[1].isUnreachable() {
+		t.Errorf("Expected unreachable mirror, got %v", results[1])
+	}
+	if err := instanceFailure(results); err != nil {
+		t.Errorf("Expected no failure for the unreachable mirror, got %v", err)
+	}
+	if queued := queueUnreachableInstances("https://example.org/", submissionOptions{}, results); queued != 1 {
+		t.Errorf("Expected the url to be queued for the mirror, got %d", queued)
+	}
+	if items := pendingQueue.snapshot(); len(items) != 1 || items[0].Instance != offline.URL {
+		t.Errorf("Unexpected queue %v", items)
+	}
+
+	results = sendURLToInstances("no url", submissionOptions{}, nil)
+	if instanceFailure(results) == nil {
+		t.Error("Expected invalid url to fail")
+	}
+}
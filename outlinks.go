@@ -0,0 +1,105 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// upper limit of bytes read of a page to collect its outlinks
+const maxOutlinkPageSize = 10 * 1024 * 1024
+
+var hrefPattern = regexp.MustCompile("(?i)<a\\s[^>]*?href\\s*=\\s*[\"']([^\"']+)[\"']")
+
+// load the page of the given url and collect all of its outlinks
+func fetchOutlinks(pageURL string) ([]string, error) {
+	resp, err := newHTTPClient().Get(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s", tWithArgs("UnexpectedStatusCode", struct {
+			Code int
+		}{Code: resp.StatusCode}))
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOutlinkPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return extractOutlinks(resp.Request.URL, content), nil
+}
+
+// extract absolute, unique http(s) links of the page content without fragments and the page itself
+func extractOutlinks(pageURL *url.URL, content []byte) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, match := range hrefPattern.FindAllSubmatch(content, -1) {
+		ref, err := url.Parse(strings.TrimSpace(html.UnescapeString(string(match[1]))))
+		if err != nil {
+			continue
+		}
+		link := pageURL.ResolveReference(ref)
+		link.Fragment = ""
+		link.RawFragment = ""
+		linkStr := link.String()
+		if !isURL(linkStr) || linkStr == pageURL.String() || seen[linkStr] {
+			continue
+		}
+		seen[linkStr] = true
+		links = append(links, linkStr)
+	}
+	return links
+}
+
+// outlinkFilter selects outlinks by an optional include and exclude regular expression
+type outlinkFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func newOutlinkFilter(include string, exclude string) (*outlinkFilter, error) {
+	filter := &outlinkFilter{}
+	var err error
+	if len(strings.TrimSpace(include)) > 0 {
+		if filter.include, err = regexp.Compile(include); err != nil {
+			return nil, err
+		}
+	}
+	if len(strings.TrimSpace(exclude)) > 0 {
+		if filter.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+func (f *outlinkFilter) matches(link string) bool {
+	if f.include != nil && !f.include.MatchString(link) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(link) {
+		return false
+	}
+	return true
+}
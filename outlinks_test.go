@@ -0,0 +1,59 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestExtractOutlinks(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.org/blog/index.html")
+	content := []byte(`<a href="/about">About</a>
+		<a class="x" href='post-1.html#comments'>Post</a>
+		<A HREF="https://other.org/?a=1&amp;b=2">Other</A>
+		<a href="mailto:mail@example.org">Mail</a>
+		<a href="#top">Top</a>
+		<a href="/about">About again</a>
+		<link href="/style.css">`)
+	links := extractOutlinks(pageURL, content)
+	expected := []string{
+		"https://example.org/about",
+		"https://example.org/blog/post-1.html",
+		"https://other.org/?a=1&b=2",
+	}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("Expected %v, got %v", expected, links)
+	}
+}
+
+func TestOutlinkFilter(t *testing.T) {
+	filter, err := newOutlinkFilter("example\\.org", "/tag/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.matches("https://example.org/post") {
+		t.Error("Expected included link to match")
+	}
+	if filter.matches("https://example.org/tag/news") || filter.matches("https://other.org/") {
+		t.Error("Expected excluded links not to match")
+	}
+	if _, err = newOutlinkFilter("(", ""); err == nil {
+		t.Error("Expected error for invalid regular expression")
+	}
+}
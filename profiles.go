@@ -0,0 +1,190 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+)
+
+const (
+	defaultProfileName = "Default"
+	defaultInstanceURL = "http://127.0.0.1:8000"
+)
+
+// instanceTarget url and credentials of an archivebox instance
+type instanceTarget struct {
+	InstanceURL string `json:"instance_url"`
+	Username    string `json:"username"`
+	// the secrets are kept in the credential store, see saveProfiles
+	Password string `json:"password,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
+	// further urls of the same instance, e.g. in the lan and via vpn, probed in order if there are any
+	AlternativeURLs []string `json:"alternative_urls,omitempty"`
+	// ca, client certificate and pinning of the connections to the instance
+	TLS tlsSettings `json:"tls,omitzero"`
+	// proxy of the connections to the instance
+	Proxy proxySettings `json:"proxy,omitzero"`
+	// headers of an authenticating reverse proxy
+	ProxyAuth proxyAuthSettings `json:"proxy_auth,omitzero"`
+}
+
+// instanceProfile connection settings and submission defaults of an archivebox instance
+type instanceProfile struct {
+	instanceTarget
+	Tags           []string `json:"tags,omitempty"`
+	ArchiveMethods []string `json:"archive_methods,omitempty"`
+	// further instances every submission is sent to, e.g. for redundancy
+	Mirrors []instanceTarget `json:"mirrors,omitempty"`
+}
+
+// the instance of the profile followed by its mirrors
+func (p instanceProfile) targets() []instanceTarget {
+	return append([]instanceTarget{p.instanceTarget}, p.Mirrors...)
+}
+
+// name of the profile used for connections and submissions
+var activeProfileName = defaultProfileName
+
+// profiles by name, the single instance settings of older versions are migrated to the default profile
+func loadProfiles() map[string]instanceProfile {
+	profiles := map[string]instanceProfile{}
+	profilesJSON := fyneApplication.Preferences().StringWithFallback(preferenceProfiles, "")
+	if len(profilesJSON) > 0 {
+		if err := json.Unmarshal([]byte(profilesJSON), &profiles); err != nil {
+			log.Printf("Problem reading instance profiles: %v\n", err)
+		}
+	}
+	if len(profiles) == 0 {
+		profiles[defaultProfileName] = migrateLegacyProfile()
+		saveProfiles(profiles)
+		return profiles
+	}
+	// the secrets stay in the preferences until the credential store can take them
+	isMigrationNeeded := hasPlaintextSecrets(profiles) && credentialStoreProblem() == nil
+	for name, profile := range profiles {
+		loadTargetSecrets(&profile.instanceTarget)
+		for i := range profile.Mirrors {
+			loadTargetSecrets(&profile.Mirrors[i])
+		}
+		profiles[name] = profile
+	}
+	if isMigrationNeeded {
+		// passwords of older versions are moved to the credential store
+		saveProfiles(profiles)
+	}
+	return profiles
+}
+
+func hasPlaintextSecrets(profiles map[string]instanceProfile) bool {
+	for _, profile := range profiles {
+		for _, target := range profile.targets() {
+			for _, field := range target.secrets() {
+				if len(*field.value) > 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// the passwords and api keys are written to the credential store, they are only kept in the preferences
+// as long as the credential store is locked or not available
+func saveProfiles(profiles map[string]instanceProfile) {
+	if storeProfileSecrets(profiles) {
+		withoutSecrets := map[string]instanceProfile{}
+		for name, profile := range profiles {
+			profile.clearSecrets()
+			mirrors := make([]instanceTarget, len(profile.Mirrors))
+			for i, mirror := range profile.Mirrors {
+				mirror.clearSecrets()
+				mirrors[i] = mirror
+			}
+			profile.Mirrors = mirrors
+			withoutSecrets[name] = profile
+		}
+		profiles = withoutSecrets
+	}
+	profilesJSON, err := json.Marshal(profiles)
+	if err != nil {
+		log.Printf("Problem saving instance profiles: %v\n", err)
+		return
+	}
+	fyneApplication.Preferences().SetString(preferenceProfiles, string(profilesJSON))
+}
+
+// move the instance settings of older versions into a profile
+func migrateLegacyProfile() instanceProfile {
+	preferences := fyneApplication.Preferences()
+	profile := instanceProfile{
+		instanceTarget: instanceTarget{
+			InstanceURL: preferences.StringWithFallback(preferenceInstanceURL, defaultInstanceURL),
+			Username:    preferences.StringWithFallback(preferenceUsername, ""),
+			Password:    preferences.StringWithFallback(preferencePassword, ""),
+			APIKey:      preferences.StringWithFallback(preferenceAPIKey, ""),
+		},
+		ArchiveMethods: preferences.StringListWithFallback(preferenceArchiveMethods, []string{}),
+	}
+	for _, key := range []string{preferenceInstanceURL, preferenceUsername, preferencePassword, preferenceAPIKey, preferenceArchiveMethods} {
+		preferences.RemoveValue(key)
+	}
+	return profile
+}
+
+func profileNames(profiles map[string]instanceProfile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func currentProfile() instanceProfile {
+	return loadProfiles()[activeProfileName]
+}
+
+func updateCurrentProfile(updateFunc func(profile *instanceProfile)) {
+	profiles := loadProfiles()
+	profile := profiles[activeProfileName]
+	updateFunc(&profile)
+	profiles[activeProfileName] = profile
+	saveProfiles(profiles)
+}
+
+// use the profile for the following connections and submissions, an empty name selects the stored active profile
+func activateProfile(name string) error {
+	profiles := loadProfiles()
+	if len(name) == 0 {
+		name = fyneApplication.Preferences().StringWithFallback(preferenceActiveProfile, defaultProfileName)
+		if _, ok := profiles[name]; !ok {
+			name = profileNames(profiles)[0]
+		}
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile '%s', available profiles: %v", name, profileNames(profiles))
+	}
+	activeProfileName = name
+	appConfig.InstanceURL = profile.InstanceURL
+	selectedArchiveMethods = sortArchiveMethods(profile.ArchiveMethods)
+	resetInstanceSessions()
+	return nil
+}
@@ -0,0 +1,66 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestProfileMigrationAndActivation(t *testing.T) {
+	fyneApplication = test.NewApp()
+	preferences := fyneApplication.Preferences()
+	preferences.SetString(preferenceInstanceURL, "https://archive.example.org:443")
+	preferences.SetString(preferenceUsername, "admin")
+	preferences.SetString(preferencePassword, "secret")
+	preferences.SetStringList(preferenceArchiveMethods, []string{"pdf", "wget"})
+
+	profiles := loadProfiles()
+	expected := instanceProfile{
+		instanceTarget: instanceTarget{InstanceURL: "https://archive.example.org:443", Username: "admin", Password: "secret"},
+		ArchiveMethods: []string{"pdf", "wget"},
+	}
+	if !reflect.DeepEqual(profiles, map[string]instanceProfile{defaultProfileName: expected}) {
+		t.Errorf("Unexpected migrated profiles %v", profiles)
+	}
+	if len(preferences.String(preferencePassword)) > 0 {
+		t.Error("Expected the migrated password to be removed")
+	}
+
+	profiles["Personal"] = instanceProfile{instanceTarget: instanceTarget{InstanceURL: "http://127.0.0.1:8000"}, Tags: []string{"me"}}
+	saveProfiles(profiles)
+	if err := activateProfile("Personal"); err != nil {
+		t.Fatal(err)
+	}
+	if appConfig.InstanceURL != "http://127.0.0.1:8000" || len(selectedArchiveMethods) != 0 || currentProfile().Tags[0] != "me" {
+		t.Errorf("Unexpected state after activation: %s, %v", appConfig.InstanceURL, selectedArchiveMethods)
+	}
+	saveSelectedArchiveMethods([]string{"wget", "pdf"})
+	if methods := loadProfiles()["Personal"].ArchiveMethods; !reflect.DeepEqual(methods, []string{"pdf", "wget"}) {
+		t.Errorf("Expected archive methods to be stored in the profile, got %v", methods)
+	}
+	if err := activateProfile("Unknown"); err == nil || activeProfileName != "Personal" {
+		t.Error("Expected unknown profile to be rejected")
+	}
+
+	preferences.SetString(preferenceActiveProfile, "Removed")
+	if err := activateProfile(""); err != nil || activeProfileName != defaultProfileName {
+		t.Errorf("Expected fallback to the first profile, got %s, %v", activeProfileName, err)
+	}
+}
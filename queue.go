@@ -0,0 +1,294 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+const queueFileName = "queue.json"
+
+// interval of the automatic replay of pending queue items
+const queueReplayInterval = 1 * time.Minute
+
+type queueItemStatus string
+
+const (
+	queueItemPending queueItemStatus = "pending" // waiting for archivebox to be reachable
+	queueItemSending queueItemStatus = "sending"
+	queueItemFailed  queueItemStatus = "failed" // rejected, not replayed automatically
+)
+
+type queueItem struct {
+	ID        string            `json:"id"`
+	URL       string            `json:"url"`
+	Options   submissionOptions `json:"options"`
+	Profile   string            `json:"profile,omitempty"`  // instance profile the url is sent to
+	Instance  string            `json:"instance,omitempty"` // url of the mirror, empty for the instance of the profile
+	Status    queueItemStatus   `json:"status"`
+	LastError string            `json:"last_error,omitempty"`
+	Attempts  int               `json:"attempts"`
+	QueuedAt  time.Time         `json:"queued_at"`
+}
+
+// submissionQueue durable list of submissions which could not be sent to archivebox yet
+type submissionQueue struct {
+	mutex      sync.Mutex
+	replaying  atomicBool
+	path       string
+	items      []*queueItem
+	onChange   func()
+	lastItemID int64
+}
+
+var pendingQueue *submissionQueue
+
+// load the queue stored in the storage root of the app
+func loadSubmissionQueue(storageRoot string) *submissionQueue {
+	queue := &submissionQueue{path: filepath.Join(storageRoot, queueFileName)}
+	content, err := os.ReadFile(queue.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Problem reading submission queue: %v\n", err)
+		}
+		return queue
+	}
+	if err = json.Unmarshal(content, &queue.items); err != nil {
+		log.Printf("Problem parsing submission queue: %v\n", err)
+		return queue
+	}
+	for _, item := range queue.items {
+		// an interrupted replay is repeated
+		if item.Status == queueItemSending {
+			item.Status = queueItemPending
+		}
+	}
+	return queue
+}
+
+// write the queue to a temporary file at first to not lose it on failures
+func (q *submissionQueue) save() {
+	content, err := json.MarshalIndent(q.items, "", "  ")
+	if err != nil {
+		log.Printf("Problem serializing submission queue: %v\n", err)
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(q.path), 0700); err != nil {
+		log.Printf("Problem creating storage directory: %v\n", err)
+		return
+	}
+	tmpPath := q.path + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0600); err != nil {
+		log.Printf("Problem writing submission queue: %v\n", err)
+		return
+	}
+	if err = os.Rename(tmpPath, q.path); err != nil {
+		log.Printf("Problem writing submission queue: %v\n", err)
+	}
+}
+
+// must be called with locked mutex
+func (q *submissionQueue) changed() {
+	q.save()
+	if q.onChange != nil {
+		q.onChange()
+	}
+}
+
+// instanceURL is the url of the mirror the submission is for, empty for the instance of the profile
+func (q *submissionQueue) add(urlToSave string, options submissionOptions, instanceURL string, reason error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	itemID := time.Now().UnixNano()
+	if itemID <= q.lastItemID {
+		itemID = q.lastItemID + 1
+	}
+	q.lastItemID = itemID
+	item := &queueItem{
+		ID:       strconv.FormatInt(itemID, 36),
+		URL:      urlToSave,
+		Options:  options,
+		Profile:  activeProfileName,
+		Instance: instanceURL,
+		Status:   queueItemPending,
+		QueuedAt: time.Now(),
+	}
+	if reason != nil {
+		item.LastError = localizeError(reason)
+	}
+	q.items = append(q.items, item)
+	log.Printf("Queued url '%s'\n", urlToSave)
+	q.changed()
+}
+
+// copy of the current items, safe to be used by the ui
+func (q *submissionQueue) snapshot() []queueItem {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	items := make([]queueItem, 0, len(q.items))
+	for _, item := range q.items {
+		items = append(items, *item)
+	}
+	return items
+}
+
+func (q *submissionQueue) size() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+func (q *submissionQueue) update(itemID string, updateFunc func(item *queueItem)) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, item := range q.items {
+		if item.ID == itemID {
+			updateFunc(item)
+			q.changed()
+			return
+		}
+	}
+}
+
+func (q *submissionQueue) remove(itemID string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, item := range q.items {
+		if item.ID == itemID {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.changed()
+			return
+		}
+	}
+}
+
+// mark an item to be sent again with the next replay
+func (q *submissionQueue) retry(itemID string) {
+	q.update(itemID, func(item *queueItem) {
+		item.Status = queueItemPending
+	})
+	go q.replay()
+}
+
+func (q *submissionQueue) edit(itemID string, newURL string) {
+	q.update(itemID, func(item *queueItem) {
+		item.URL = newURL
+		item.Status = queueItemPending
+		item.LastError = ""
+	})
+}
+
+// send all pending items of the active profile to archivebox, items are removed after a successful submission
+func (q *submissionQueue) replay() {
+	// a replay started by the timer and one started by the user must not send the same items twice
+	if !q.replaying.trySetTrue() {
+		return
+	}
+	defer q.replaying.setFalse()
+
+	var pendingItems []queueItem
+	for _, item := range q.snapshot() {
+		// items of other profiles are kept until their profile is used again
+		if item.Status == queueItemPending && (len(item.Profile) == 0 || item.Profile == activeProfileName) {
+			pendingItems = append(pendingItems, item)
+		}
+	}
+
+	sent := 0
+	// instances which are not reachable, their remaining items are tried later
+	unreachable := map[*instanceSession]bool{}
+	for _, pendingItem := range pendingItems {
+		session := sessionOf(pendingItem.Instance)
+		if session == nil || unreachable[session] {
+			// the mirror was removed from the profile or is gone
+			continue
+		}
+		if err := session.connect(); err != nil {
+			if isDebug {
+				log.Printf("Queue replay skipped, archivebox '%s' is not reachable\n", session.target.InstanceURL)
+			}
+			unreachable[session] = true
+			continue
+		}
+		itemID := pendingItem.ID
+		var urlToSave string
+		var options submissionOptions
+		q.update(itemID, func(item *queueItem) {
+			item.Status = queueItemSending
+			item.Attempts++
+			urlToSave = item.URL
+			options = item.Options
+		})
+		if len(urlToSave) == 0 {
+			// item was dropped in the meantime
+			continue
+		}
+		hasWorked, err := session.send(urlToSave, options)
+		if hasWorked && err == nil {
+			q.remove(itemID)
+			sent++
+			continue
+		}
+		q.update(itemID, func(item *queueItem) {
+			if err != nil {
+				item.LastError = localizeError(err)
+			}
+			if archivebox.IsConnectionError(err) {
+				item.Status = queueItemPending
+			} else {
+				item.Status = queueItemFailed
+			}
+		})
+		if archivebox.IsConnectionError(err) {
+			// archivebox is gone again, try the remaining items later
+			unreachable[session] = true
+		}
+	}
+
+	if sent > 0 {
+		log.Printf("Replayed %d queued urls\n", sent)
+		fyneApplication.SendNotification(&fyne.Notification{
+			Title: tWithArgs("NotificationTitle", struct {
+				APP_NAME string
+			}{APP_NAME: appConfig.AppName}),
+			Content: tWithArgs("QueuedURLsSent", struct {
+				Count int
+			}{Count: sent}),
+		})
+	}
+}
+
+// replays the queue periodically in background
+func (q *submissionQueue) startAutoReplay() {
+	go func() {
+		q.replay()
+		ticker := time.NewTicker(queueReplayInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			q.replay()
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubmissionQueuePersistence(t *testing.T) {
+	storageRoot := t.TempDir()
+	queue := loadSubmissionQueue(storageRoot)
+	queue.add("https://example.org/a", submissionOptions{Tags: []string{"news"}, Depth: 0}, "", errors.New("offline"))
+	queue.add("https://example.org/b", submissionOptions{}, "https://mirror.example.org", nil)
+	items := queue.snapshot()
+	if len(items) != 2 || items[0].ID == items[1].ID {
+		t.Fatalf("Expected two items with distinct ids, got %v", items)
+	}
+	queue.update(items[1].ID, func(item *queueItem) {
+		item.Status = queueItemSending
+	})
+
+	reloaded := loadSubmissionQueue(storageRoot).snapshot()
+	if len(reloaded) != 2 {
+		t.Fatalf("Expected two persisted items, got %d", len(reloaded))
+	}
+	if reloaded[0].Options.Tags[0] != "news" || reloaded[0].LastError != "offline" {
+		t.Errorf("Unexpected persisted item %v", reloaded[0])
+	}
+	if reloaded[1].Status != queueItemPending {
+		t.Errorf("Expected interrupted item to be pending again, got %s", reloaded[1].Status)
+	}
+
+	queue.edit(items[0].ID, "https://example.org/c")
+	queue.remove(items[1].ID)
+	reloaded = loadSubmissionQueue(storageRoot).snapshot()
+	if len(reloaded) != 1 || reloaded[0].URL != "https://example.org/c" {
+		t.Errorf("Unexpected queue after edit and removal: %v", reloaded)
+	}
+}
+
+func TestSubmissionQueueSingleReplay(t *testing.T) {
+	queue := loadSubmissionQueue(t.TempDir())
+	queue.add("https://example.org/a", submissionOptions{}, "", errors.New("offline"))
+	// a replay is running already
+	if !queue.replaying.trySetTrue() || queue.replaying.trySetTrue() {
+		t.Fatal("Expected the first replay only to start")
+	}
+	queue.replay()
+	if items := queue.snapshot(); len(items) != 1 || items[0].Status != queueItemPending {
+		t.Errorf("Expected the item to be left to the running replay, got %v", items)
+	}
+	if !queue.replaying.isSet() {
+		t.Errorf("Expected the running replay to stay marked")
+	}
+}
@@ -0,0 +1,83 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+const (
+	defaultMaxRetries        = 3
+	defaultRetryBaseDelay    = 2 // seconds
+	maxRetryDelay            = 60 * time.Second
+	maxAllowedRetries        = 10
+	maxAllowedRetryBaseDelay = 60 // seconds
+)
+
+type retryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+}
+
+func loadRetryPolicy() retryPolicy {
+	maxRetries := fyneApplication.Preferences().IntWithFallback(preferenceMaxRetries, defaultMaxRetries)
+	baseDelay := fyneApplication.Preferences().IntWithFallback(preferenceRetryBaseDelay, defaultRetryBaseDelay)
+	return retryPolicy{
+		MaxRetries: min(max(maxRetries, 0), maxAllowedRetries),
+		BaseDelay:  time.Duration(min(max(baseDelay, 0), maxAllowedRetryBaseDelay)) * time.Second,
+	}
+}
+
+// exponential backoff of the given retry (starting with 1) with jitter in the upper half of the delay
+func (p retryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// send the url to the instance and retry temporary failures, onRetry is called before each retry
+func sendURLWithRetries(session *instanceSession, urlToSave string, options submissionOptions,
+	onRetry func(attempt int, maxAttempts int, err error)) (bool, error) {
+	policy := loadRetryPolicy()
+	for retry := 1; ; retry++ {
+		hasWorked, err := session.send(urlToSave, options)
+		if err == nil || retry > policy.MaxRetries || !archivebox.IsRetryable(err) {
+			return hasWorked, err
+		}
+		if onRetry != nil {
+			onRetry(retry+1, policy.MaxRetries+1, err)
+		}
+		time.Sleep(policy.backoff(retry))
+	}
+}
+
+func retryText(attempt int, maxAttempts int, err error) string {
+	return tWithArgs("RetryAttempt", struct {
+		Attempt     int
+		MaxAttempts int
+		ERROR       string
+	}{Attempt: attempt, MaxAttempts: maxAttempts, ERROR: localizeError(err)})
+}
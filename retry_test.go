@@ -0,0 +1,37 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{MaxRetries: 5, BaseDelay: 2 * time.Second}
+	for retry, maxDelay := range map[int]time.Duration{1: 2 * time.Second, 2: 4 * time.Second, 3: 8 * time.Second, 10: maxRetryDelay} {
+		for i := 0; i < 20; i++ {
+			delay := policy.backoff(retry)
+			if delay < maxDelay/2 || delay > maxDelay {
+				t.Errorf("Delay %v of retry %d is not between %v and %v", delay, retry, maxDelay/2, maxDelay)
+			}
+		}
+	}
+	if (retryPolicy{}).backoff(1) != 0 {
+		t.Error("Expected no delay without base delay")
+	}
+}
@@ -0,0 +1,238 @@
+//go:build linux || freebsd || openbsd || netbsd || dragonfly
+
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceName           = "org.freedesktop.secrets"
+	secretServicePath           = "/org/freedesktop/secrets"
+	secretServiceInterface      = "org.freedesktop.Secret.Service"
+	secretItemInterface         = "org.freedesktop.Secret.Item"
+	secretPromptInterface       = "org.freedesktop.Secret.Prompt"
+	secretDefaultCollectionPath = "/org/freedesktop/secrets/aliases/default"
+
+	// time the user has to answer an unlock prompt of the keyring
+	secretPromptTimeout = 2 * time.Minute
+)
+
+// secret as transferred by the secret service api, the "plain" algorithm does not need parameters
+type secretServiceSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// secretServiceStore secrets in the keyring of the desktop, e.g. gnome keyring or kwallet
+type secretServiceStore struct {
+	mutex   sync.Mutex
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+	// the items are read once, the keyring is asked for every profile load otherwise.
+	// Missing items are cached as empty secrets, most profiles lack some of the secrets.
+	cache map[string]string
+}
+
+func openSecretServiceStore() (credentialStore, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err = conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &secretServiceStore{conn: conn, session: session, cache: map[string]string{}}, nil
+}
+
+func (s *secretServiceStore) attributes(key string) map[string]string {
+	attributes := map[string]string{"application": appConfig.AppID}
+	if len(key) > 0 {
+		attributes["key"] = key
+	}
+	return attributes
+}
+
+// unlocked items with the attributes, locked items are unlocked at first
+func (s *secretServiceStore) searchItems(attributes map[string]string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".SearchItems", 0, attributes).Store(&unlocked, &locked)
+	if err != nil {
+		return nil, err
+	}
+	if len(locked) > 0 {
+		if err = s.unlock(locked); err != nil {
+			return nil, err
+		}
+		unlocked = append(unlocked, locked...)
+	}
+	return unlocked, nil
+}
+
+func (s *secretServiceStore) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".Unlock", 0, objects).Store(&unlocked, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.runPrompt(prompt)
+}
+
+// shows the prompt of the keyring, e.g. to enter the password of the keyring, and waits for the user
+func (s *secretServiceStore) runPrompt(prompt dbus.ObjectPath) error {
+	if prompt == "/" {
+		// no prompt needed
+		return nil
+	}
+	matchOptions := []dbus.MatchOption{dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(secretPromptInterface)}
+	if err := s.conn.AddMatchSignal(matchOptions...); err != nil {
+		return err
+	}
+	defer s.conn.RemoveMatchSignal(matchOptions...)
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(secretServiceName, prompt).Call(secretPromptInterface+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+	timeout := time.After(secretPromptTimeout)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != prompt || signal.Name != secretPromptInterface+".Completed" {
+				continue
+			}
+			if dismissed, ok := signal.Body[0].(bool); ok && dismissed {
+				return errors.New("keyring prompt was dismissed")
+			}
+			return nil
+		case <-timeout:
+			return errors.New("no answer to the keyring prompt")
+		}
+	}
+}
+
+func (s *secretServiceStore) get(key string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if secret, ok := s.cache[key]; ok {
+		return secret, nil
+	}
+	items, err := s.searchItems(s.attributes(key))
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		s.cache[key] = ""
+		return "", nil
+	}
+	var secret secretServiceSecret
+	err = s.conn.Object(secretServiceName, items[0]).Call(secretItemInterface+".GetSecret", 0, s.session).Store(&secret)
+	if err != nil {
+		return "", err
+	}
+	s.cache[key] = string(secret.Value)
+	return s.cache[key], nil
+}
+
+func (s *secretServiceStore) set(key string, secret string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// the keyring is asked again if the item cannot be created
+	delete(s.cache, key)
+	collection := dbus.ObjectPath(secretDefaultCollectionPath)
+	if err := s.unlock([]dbus.ObjectPath{collection}); err != nil {
+		return err
+	}
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(appConfig.AppName + " " + key),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(s.attributes(key)),
+	}
+	value := secretServiceSecret{Session: s.session, Parameters: []byte{}, Value: []byte(secret), ContentType: "text/plain"}
+	var item, prompt dbus.ObjectPath
+	err := s.conn.Object(secretServiceName, collection).
+		Call("org.freedesktop.Secret.Collection.CreateItem", 0, properties, value, true).Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+	if err = s.runPrompt(prompt); err != nil {
+		return err
+	}
+	s.cache[key] = secret
+	return nil
+}
+
+func (s *secretServiceStore) delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.cache, key)
+	items, err := s.searchItems(s.attributes(key))
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err = s.conn.Object(secretServiceName, item).Call(secretItemInterface+".Delete", 0).Store(&prompt); err != nil {
+			return err
+		}
+		if err = s.runPrompt(prompt); err != nil {
+			return err
+		}
+	}
+	s.cache[key] = ""
+	return nil
+}
+
+func (s *secretServiceStore) keys() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	items, err := s.searchItems(s.attributes(""))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, item := range items {
+		property, err := s.conn.Object(secretServiceName, item).GetProperty(secretItemInterface + ".Attributes")
+		if err != nil {
+			return nil, err
+		}
+		var attributes map[string]string
+		if err = property.Store(&attributes); err != nil {
+			return nil, err
+		}
+		if key, ok := attributes["key"]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,330 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// instanceSession connection state of one archivebox instance of the active profile
+type instanceSession struct {
+	target        instanceTarget
+	mutex         sync.Mutex // serializes logins of parallel submissions
+	client        *archivebox.Client
+	isConnected   bool
+	connectionErr error
+	// url the client connects to, one of the candidate urls of the target
+	endpointURL   string
+	endpointMutex sync.Mutex
+}
+
+// sessions of the instance and the mirrors of the active profile, the instance is the first one
+var instanceSessions []*instanceSession
+var instanceSessionsMutex sync.Mutex
+
+// sessions of the active profile, created on first use
+func activeSessions() []*instanceSession {
+	instanceSessionsMutex.Lock()
+	defer instanceSessionsMutex.Unlock()
+	if instanceSessions == nil {
+		for _, target := range currentProfile().targets() {
+			instanceSessions = append(instanceSessions, &instanceSession{target: target})
+		}
+	}
+	return append([]*instanceSession{}, instanceSessions...)
+}
+
+// session of the instance of the active profile, used for searches, tags and confirmations
+func primarySession() *instanceSession {
+	return activeSessions()[0]
+}
+
+// session of the instance with the url, the primary session for an empty url, nil if the profile has no such instance
+func sessionOf(instanceURL string) *instanceSession {
+	sessions := activeSessions()
+	if len(instanceURL) == 0 {
+		return sessions[0]
+	}
+	for _, session := range sessions {
+		if session.target.InstanceURL == instanceURL {
+			return session
+		}
+	}
+	return nil
+}
+
+// drop the current sessions, the next connection setup uses the current profile
+func resetInstanceSessions() {
+	doArchiveBoxLogout()
+	instanceSessionsMutex.Lock()
+	defer instanceSessionsMutex.Unlock()
+	instanceSessions = nil
+}
+
+func doArchiveBoxLogout() {
+	instanceSessionsMutex.Lock()
+	sessions := instanceSessions
+	instanceSessionsMutex.Unlock()
+	for _, session := range sessions {
+		session.logout()
+	}
+}
+
+// client of the instance, must be called with locked mutex
+func (s *instanceSession) lockedClient() (*archivebox.Client, error) {
+	if s.client == nil {
+		transport, err := newInstanceTransport(s.target)
+		if err != nil {
+			return nil, err
+		}
+		endpoint := selectEndpoint(s.target)
+		client, err := archivebox.NewClient(archivebox.Config{
+			InstanceURL:   endpoint,
+			Username:      s.target.Username,
+			Password:      s.target.Password,
+			APIKey:        s.target.APIKey,
+			AcceptTimeout: archivebox.DefaultAcceptTimeout,
+			Transport:     transport,
+			ProxyAuth:     s.target.ProxyAuth.options(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.client = client
+		s.endpointMutex.Lock()
+		s.endpointURL = endpoint
+		s.endpointMutex.Unlock()
+	}
+	return s.client, nil
+}
+
+// url the instance is reached with, the instance url until the connection is set up
+func (s *instanceSession) endpoint() string {
+	s.endpointMutex.Lock()
+	defer s.endpointMutex.Unlock()
+	if len(s.endpointURL) == 0 {
+		return s.target.InstanceURL
+	}
+	return s.endpointURL
+}
+
+func (s *instanceSession) getClient() (*archivebox.Client, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lockedClient()
+}
+
+// login if there is no session yet
+func (s *instanceSession) connect() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	client, err := s.lockedClient()
+	if err == nil && !client.IsLoggedIn() {
+		err = s.lockedLogin(client)
+		if archivebox.IsConnectionError(err) && len(s.target.AlternativeURLs) > 0 {
+			// the cached url may belong to a network with the same subnets, probe the candidates again
+			forgetEndpoint(s.target)
+			s.client = nil
+			if client, err = s.lockedClient(); err == nil {
+				err = s.lockedLogin(client)
+			}
+		}
+		if err != nil {
+			log.Printf("Problem with login to '%s'! %v\n", s.target.InstanceURL, err)
+		} else if client.UsesAPI() {
+			log.Printf("Using the rest api of '%s'\n", s.target.InstanceURL)
+		} else if client.IsAnonymous() {
+			log.Printf("Submitting anonymously to the public add form of '%s'\n", s.target.InstanceURL)
+		} else {
+			log.Printf("Session id of '%s' is set successfully", s.target.InstanceURL)
+		}
+		if err == nil {
+			logCapabilities(s.target.InstanceURL, client.Capabilities())
+		}
+	}
+	s.isConnected = err == nil
+	s.connectionErr = err
+	return err
+}
+
+// resumes the stored session of the admin login if there is one, must be called with locked mutex
+func (s *instanceSession) lockedLogin(client *archivebox.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	key := s.sessionKey(client)
+	// the rest api and the remote user header of the proxy need no session
+	isSessionReusable := isStayLoggedIn() && len(s.target.APIKey) == 0 && s.target.ProxyAuth.Mode != archivebox.ProxyAuthRemoteUser
+	if cookies := storedSessions.cookies(key); isSessionReusable && len(cookies) > 0 {
+		err := client.ResumeSession(ctx, cookies)
+		if err == nil {
+			log.Printf("Reusing the session of '%s'\n", client.InstanceURL())
+			return nil
+		}
+		if archivebox.IsConnectionError(err) || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Stored session of '%s' is not valid anymore: %v\n", client.InstanceURL(), err)
+		storedSessions.forget(key)
+	}
+	if err := client.Login(ctx); err != nil {
+		return err
+	}
+	if isStayLoggedIn() {
+		storedSessions.store(key, client.SessionCookies())
+	}
+	return nil
+}
+
+// drops the stored session if archivebox redirected to the login page, the next connection setup logs in again
+func (s *instanceSession) checkSession(err error) {
+	if !errors.Is(err, archivebox.ErrSessionExpired) {
+		return
+	}
+	log.Printf("Session of '%s' expired\n", s.endpoint())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.client != nil {
+		storedSessions.forget(s.sessionKey(s.client))
+	}
+	s.isConnected = false
+}
+
+// key of the stored session, the normalized url of the client may differ from the url of the profile
+func (s *instanceSession) sessionKey(client *archivebox.Client) string {
+	return sessionKey(client.InstanceURL(), s.target.Username)
+}
+
+// the public add form is used without login, the snapshots and tags of the admin cannot be read
+func (s *instanceSession) isAnonymous() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.client != nil && s.client.IsAnonymous()
+}
+
+// capabilities of the instance detected by the login, unknown ones are assumed to be available
+func (s *instanceSession) capabilities() archivebox.Capabilities {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.client == nil {
+		return archivebox.Capabilities{HasTags: true}
+	}
+	return s.client.Capabilities()
+}
+
+func logCapabilities(instanceURL string, capabilities archivebox.Capabilities) {
+	log.Printf("ArchiveBox %s at '%s', rest api: %t, tags: %t\n", capabilities.Version, instanceURL,
+		capabilities.HasAPI, capabilities.HasTags)
+	if !capabilities.IsSupported() {
+		log.Printf("WARNING: ArchiveBox %s of '%s' is not supported, supported are %s up to %s (excluded)\n",
+			capabilities.Version, instanceURL, archivebox.MinSupportedVersion, archivebox.FirstUnsupportedVersion)
+	}
+}
+
+// state of the last connection setup
+func (s *instanceSession) status() (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.isConnected, s.connectionErr
+}
+
+// ends the session of the admin login unless the user stays logged in
+func (s *instanceSession) logout() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.isConnected = false
+	if s.client == nil || !s.client.IsLoggedIn() {
+		// there was no login
+		return
+	}
+	key := s.sessionKey(s.client)
+	if cookies := s.client.SessionCookies(); isStayLoggedIn() && storedSessions != nil && len(cookies) > 0 {
+		// the session is resumed by the next start, the client may have logged in again in the meantime
+		storedSessions.store(key, cookies)
+		return
+	}
+	storedSessions.forget(key)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := s.client.Logout(ctx); err != nil {
+		log.Printf("Logout request failed!:%v\n", err)
+		return
+	}
+	log.Printf("Logout of '%s'\n", s.target.InstanceURL)
+}
+
+func (s *instanceSession) send(urlToSave string, options submissionOptions) (bool, error) {
+	urlToSave = strings.TrimSpace(urlToSave)
+	// validate url at first
+	if len(urlToSave) < 5 {
+		return false, fmt.Errorf("%s", t("URLTooShort"))
+	}
+	if !isURL(urlToSave) {
+		return false, fmt.Errorf("%s", t("InvalidURL"))
+	}
+	if err := s.connect(); err != nil {
+		return false, err
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	// the endpoint sometimes needs a lot of time (~60 secs) until there is a response,
+	// the client treats the submission as accepted after a short time without response
+	if err = client.Add(ctx, options.addOptions(urlToSave)); err != nil {
+		s.checkSession(err)
+		log.Printf("Problem adding url '%s' to '%s': %v\n", urlToSave, s.target.InstanceURL, err)
+		return false, err
+	}
+	log.Printf("entry add request has been accepted by '%s'\n", s.target.InstanceURL)
+	return true, nil
+}
+
+// nil if the url is not archived in the instance
+func (s *instanceSession) findSnapshot(urlToCheck string) (*archivebox.Snapshot, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+	snapshot, err := client.FindSnapshot(ctx, urlToCheck)
+	s.checkSession(err)
+	return snapshot, err
+}
+
+// all snapshots of the url in the instance, the newest first
+func (s *instanceSession) findSnapshots(urlToCheck string) ([]archivebox.Snapshot, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+	snapshots, err := client.FindSnapshots(ctx, urlToCheck)
+	s.checkSession(err)
+	return snapshots, err
+}
@@ -0,0 +1,136 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const sessionStoreFileName = "sessions.json"
+
+// cookie of an admin login, the value is all django needs to resume the session
+type storedCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// sessionStore durable admin sessions of the instances, reused by later starts if the user stays logged in
+type sessionStore struct {
+	mutex    sync.Mutex
+	path     string
+	sessions map[string][]storedCookie
+}
+
+// nil until the app is initialized, all methods are no-ops then
+var storedSessions *sessionStore
+
+// load the sessions stored in the storage root of the app
+func loadSessionStore(storageRoot string) *sessionStore {
+	store := &sessionStore{path: filepath.Join(storageRoot, sessionStoreFileName), sessions: map[string][]storedCookie{}}
+	content, err := os.ReadFile(store.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Problem reading stored sessions: %v\n", err)
+		}
+		return store
+	}
+	if err = json.Unmarshal(content, &store.sessions); err != nil {
+		log.Printf("Problem parsing stored sessions: %v\n", err)
+	}
+	return store
+}
+
+// sessions belong to the url the instance is reached with and the user
+func sessionKey(endpoint string, username string) string {
+	return username + "@" + endpoint
+}
+
+func isStayLoggedIn() bool {
+	return fyneApplication.Preferences().BoolWithFallback(preferenceStayLoggedIn, false)
+}
+
+func (s *sessionStore) cookies(key string) []*http.Cookie {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var cookies []*http.Cookie
+	for _, cookie := range s.sessions[key] {
+		cookies = append(cookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+func (s *sessionStore) store(key string, cookies []*http.Cookie) {
+	if s == nil || len(cookies) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var storedCookies []storedCookie
+	for _, cookie := range cookies {
+		storedCookies = append(storedCookies, storedCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	s.sessions[key] = storedCookies
+	s.save()
+}
+
+func (s *sessionStore) forget(key string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.sessions[key]; !ok {
+		return
+	}
+	delete(s.sessions, key)
+	s.save()
+}
+
+// drops all sessions, e.g. if the user does not want to stay logged in anymore
+func (s *sessionStore) clear() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessions = map[string][]storedCookie{}
+	s.save()
+}
+
+// must be called with locked mutex, the file is readable by the user only as it grants access to the instances
+func (s *sessionStore) save() {
+	content, err := json.MarshalIndent(s.sessions, "", "  ")
+	if err != nil {
+		log.Printf("Problem serializing sessions: %v\n", err)
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		log.Printf("Problem creating storage directory: %v\n", err)
+		return
+	}
+	if err = os.WriteFile(s.path, content, 0600); err != nil {
+		log.Printf("Problem writing sessions: %v\n", err)
+	}
+}
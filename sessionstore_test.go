@@ -0,0 +1,108 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+func TestStayLoggedIn(t *testing.T) {
+	var logins, logouts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := r.Cookie("sessionid")
+		isLoggedIn := session != nil && session.Value == "session"
+		switch {
+		case r.URL.Path == "/admin/login/" && r.Method == http.MethodGet && isLoggedIn:
+			w.Header().Set("Location", "/admin/")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == "/admin/login/" && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "csrf", Path: "/"})
+			_, _ = w.Write([]byte(`<input type="hidden" name="csrfmiddlewaretoken" value="middleware">`))
+		case r.URL.Path == "/admin/login/":
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "session", Path: "/"})
+			w.Header().Set("Location", "/")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == "/admin/logout/":
+			logouts++
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	fyneApplication = test.NewApp()
+	appConfig.initI18n()
+	if isStayLoggedIn() {
+		t.Errorf("Expected sessions not to be stored by default")
+	}
+	fyneApplication.Preferences().SetBool(preferenceStayLoggedIn, true)
+	storageRoot := t.TempDir()
+	storedSessions = loadSessionStore(storageRoot)
+	defer func() {
+		storedSessions = nil
+	}()
+	saveProfiles(map[string]instanceProfile{defaultProfileName: {
+		instanceTarget: instanceTarget{InstanceURL: server.URL, Username: "admin", Password: "secret"},
+	}})
+	if err := activateProfile(defaultProfileName); err != nil {
+		t.Fatal(err)
+	}
+	if err := setupArchiveBoxConnection(); err != nil || logins != 1 {
+		t.Fatalf("Expected login, got %v", err)
+	}
+
+	// the next start of the app resumes the stored session
+	resetInstanceSessions()
+	storedSessions = loadSessionStore(storageRoot)
+	if err := setupArchiveBoxConnection(); err != nil || logins != 1 {
+		t.Errorf("Expected resumed session without login, got %v and %d logins", err, logins)
+	}
+	if logouts != 0 {
+		t.Errorf("Expected the session to be kept")
+	}
+
+	fyneApplication.Preferences().SetBool(preferenceStayLoggedIn, false)
+	resetInstanceSessions()
+	if logouts != 1 || storedSessions.cookies(sessionKey(server.URL, "admin")) != nil {
+		t.Errorf("Expected logout without stored session")
+	}
+	if err := setupArchiveBoxConnection(); err != nil || logins != 2 {
+		t.Errorf("Expected new login, got %v and %d logins", err, logins)
+	}
+
+	// the session of a profile url which is not normalized is dropped when it expired
+	fyneApplication.Preferences().SetBool(preferenceStayLoggedIn, true)
+	saveProfiles(map[string]instanceProfile{defaultProfileName: {
+		instanceTarget: instanceTarget{InstanceURL: server.URL + "/", Username: "admin", Password: "secret"},
+	}})
+	if err := activateProfile(defaultProfileName); err != nil {
+		t.Fatal(err)
+	}
+	if err := setupArchiveBoxConnection(); err != nil || storedSessions.cookies(sessionKey(server.URL, "admin")) == nil {
+		t.Fatalf("Expected stored session, got %v", err)
+	}
+	primarySession().checkSession(archivebox.ErrSessionExpired)
+	if storedSessions.cookies(sessionKey(server.URL, "admin")) != nil {
+		t.Errorf("Expected the expired session to be dropped")
+	}
+}
@@ -0,0 +1,103 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"fyne.io/fyne/v2"
+)
+
+// upper limit of suggestions shown in the tag input
+const maxTagSuggestions = 15
+
+// fetch existing tags in background and hand them over to the tag input
+func loadTagSuggestions() {
+	tags := fetchArchiveBoxTags()
+	if isDebug {
+		log.Printf("Loaded %d tags\n", len(tags))
+	}
+	fyne.Do(func() {
+		tagEntryWidget.setKnownTags(tags)
+	})
+}
+
+// names of all tags of the instance
+func fetchArchiveBoxTags() []string {
+	session := primarySession()
+	if isConnected, _ := session.status(); !isConnected || session.isAnonymous() || !session.capabilities().HasTags {
+		return nil
+	}
+	client, err := session.getClient()
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+	tags, err := client.Tags(ctx)
+	if err != nil {
+		session.checkSession(err)
+		log.Printf("Problem fetching tag list: %v\n", err)
+	}
+	return tags
+}
+
+// split comma separated user input into a list of unique tags
+func parseTags(input string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(input, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// completions for the last (incomplete) tag of the input, each suggestion contains the full input text
+func tagSuggestions(input string, knownTags []string) []string {
+	prefix := ""
+	current := input
+	if idx := strings.LastIndex(input, ","); idx >= 0 {
+		prefix = strings.TrimRight(input[:idx+1], " ") + " "
+		current = input[idx+1:]
+	}
+	current = strings.ToLower(strings.TrimSpace(current))
+
+	alreadyUsed := map[string]bool{}
+	for _, tag := range parseTags(prefix) {
+		alreadyUsed[strings.ToLower(tag)] = true
+	}
+
+	var suggestions []string
+	for _, tag := range knownTags {
+		lowerTag := strings.ToLower(tag)
+		if alreadyUsed[lowerTag] || !strings.HasPrefix(lowerTag, current) {
+			continue
+		}
+		suggestions = append(suggestions, prefix+tag)
+		if len(suggestions) >= maxTagSuggestions {
+			break
+		}
+	}
+	return suggestions
+}
@@ -0,0 +1,47 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tags := parseTags(" news, Tech,,news ,tech, a b ")
+	expected := []string{"news", "Tech", "a b"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected %v, got %v", expected, tags)
+	}
+	if len(parseTags("  ")) != 0 {
+		t.Error("Expected no tags for blank input")
+	}
+}
+
+func TestTagSuggestions(t *testing.T) {
+	known := []string{"golang", "Google", "news"}
+	suggestions := tagSuggestions("news, go", known)
+	expected := []string{"news, golang", "news, Google"}
+	if !reflect.DeepEqual(suggestions, expected) {
+		t.Errorf("Expected %v, got %v", expected, suggestions)
+	}
+	suggestions = tagSuggestions("golang,", known)
+	expected = []string{"golang, Google", "golang, news"}
+	if !reflect.DeepEqual(suggestions, expected) {
+		t.Errorf("Expected %v, got %v", expected, suggestions)
+	}
+}
@@ -0,0 +1,121 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/emschu/archivebox-quick-add/archivebox"
+)
+
+// tlsSettings of the connections to an instance
+type tlsSettings struct {
+	CAFile     string   `json:"ca_file,omitempty"`
+	CertFile   string   `json:"cert_file,omitempty"`
+	KeyFile    string   `json:"key_file,omitempty"`
+	PinnedKeys []string `json:"pinned_keys,omitempty"`
+	Insecure   bool     `json:"insecure,omitempty"`
+}
+
+func (s tlsSettings) options() archivebox.TLSOptions {
+	return archivebox.TLSOptions{
+		CAFile:             s.CAFile,
+		CertFile:           s.CertFile,
+		KeyFile:            s.KeyFile,
+		PinnedKeys:         s.PinnedKeys,
+		InsecureSkipVerify: s.Insecure,
+	}
+}
+
+// kinds of proxy usage of an instance
+const (
+	proxyModeSystem = ""       // proxy of the environment variables
+	proxyModeNone   = "none"   // direct connection
+	proxyModeCustom = "custom" // proxy of the settings
+)
+
+// proxySettings of the connections to an instance
+type proxySettings struct {
+	Mode     string `json:"mode,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Username string `json:"username,omitempty"`
+	// the secret is kept in the credential store, see saveProfiles
+	Password string   `json:"password,omitempty"`
+	NoProxy  []string `json:"no_proxy,omitempty"`
+}
+
+func (s proxySettings) options() archivebox.ProxyOptions {
+	switch s.Mode {
+	case proxyModeNone:
+		return archivebox.ProxyOptions{Direct: true}
+	case proxyModeCustom:
+		return archivebox.ProxyOptions{URL: s.URL, Username: s.Username, Password: s.Password, NoProxy: s.NoProxy}
+	default:
+		return archivebox.ProxyOptions{}
+	}
+}
+
+// proxyAuthSettings of an authenticating reverse proxy in front of an instance
+type proxyAuthSettings struct {
+	Mode     archivebox.ProxyAuthMode `json:"mode,omitempty"`
+	Username string                   `json:"username,omitempty"`
+	// the secrets are kept in the credential store, see saveProfiles
+	Password   string `json:"password,omitempty"`
+	Token      string `json:"token,omitempty"`
+	Header     string `json:"header,omitempty"`
+	RemoteUser string `json:"remote_user,omitempty"`
+}
+
+func (s proxyAuthSettings) options() archivebox.ProxyAuth {
+	return archivebox.ProxyAuth{
+		Mode:       s.Mode,
+		Username:   s.Username,
+		Password:   s.Password,
+		Token:      s.Token,
+		Header:     s.Header,
+		RemoteUser: s.RemoteUser,
+	}
+}
+
+// transport of all requests to the instance
+func newInstanceTransport(target instanceTarget) (http.RoundTripper, error) {
+	if target.TLS.Insecure {
+		log.Printf("WARNING: the certificate of '%s' is not verified, the connection can be intercepted!\n", target.InstanceURL)
+	}
+	transport, err := archivebox.NewTransport(target.TLS.options())
+	if err != nil {
+		return nil, err
+	}
+	if err = target.Proxy.options().Apply(transport); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// client of requests to other hosts than the instance, e.g. to collect outlinks, with the proxy of the active profile
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if err := currentProfile().Proxy.options().Apply(transport); err != nil {
+		log.Printf("Problem with the proxy settings, the proxy of the environment is used: %v\n", err)
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+	}
+}
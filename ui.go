@@ -18,23 +18,35 @@
 package main
 
 import (
+	"fmt"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/cmd/fyne_settings/settings"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/validation"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/emschu/archivebox-quick-add/archivebox"
 	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var isAppearanceWindowOpen = false
 
+// rows of the queue dialog, nil if the dialog is closed
+var queueRows *fyne.Container
+
 func pasteClipboard() {
 	clipboard := window.Clipboard()
 	if clipboard != nil {
 		currentClipboard := clipboard.Content()
-		if len(currentClipboard) > 0 && isURL(currentClipboard) {
+		if len(currentClipboard) > 0 && len(extractURLs(currentClipboard)) > 0 {
 			inputEntryWidget.SetText(strings.TrimSpace(currentClipboard))
 		}
 	} else {
@@ -42,35 +54,1066 @@ func pasteClipboard() {
 	}
 }
 
+func newDepthRadioGroup(depth int) *widget.RadioGroup {
+	radioGroup := widget.NewRadioGroup([]string{"0", "1"}, func(string) {})
+	radioGroup.Horizontal = true
+	radioGroup.Required = true
+	radioGroup.SetSelected(strconv.Itoa(depth))
+	return radioGroup
+}
+
+func selectedDepth() int {
+	depth, err := strconv.Atoi(depthRadioGroup.Selected)
+	if err != nil {
+		return 0
+	}
+	return depth
+}
+
+// lists the outlinks of the page to let the user pick the ones archived along with the page
+func showOutlinkPreview(pageURL string, onConfirm func(selectedOutlinks []string)) {
+	appSessionState.IsSubmissionBlocked.setTrue()
+	appSessionState.IsCloseBlocked.setTrue()
+	infoLabel.SetText(t("LoadingOutlinks"))
+	go func() {
+		outlinks, err := fetchOutlinks(pageURL)
+		fyne.Do(func() {
+			if err != nil {
+				appSessionState.IsSubmissionBlocked.setFalse()
+				appSessionState.IsCloseBlocked.setFalse()
+				infoLabel.SetText(tWithArgs("ProblemLoadingOutlinks", struct {
+					ERROR string
+				}{ERROR: err.Error()}))
+				return
+			}
+			infoLabel.SetText("")
+			showURLSelectionDialog(t("Outlinks"), pageURL, outlinks, onConfirm)
+		})
+	}()
+}
+
+// checklist of urls with include and exclude filters, all urls are selected initially
+func showURLSelectionDialog(title string, description string, urls []string, onConfirm func(selectedURLs []string)) {
+	appSessionState.IsSubmissionBlocked.setTrue()
+	appSessionState.IsCloseBlocked.setTrue()
+
+	checkList := container.NewVBox()
+	countLabel := widget.NewLabel("")
+	updateCount := func() {
+		selected := 0
+		for _, obj := range checkList.Objects {
+			if obj.(*widget.Check).Checked {
+				selected++
+			}
+		}
+		countLabel.SetText(tWithArgs("SelectedURLs", struct {
+			Selected int
+			Total    int
+		}{Selected: selected, Total: len(urls)}))
+	}
+	for _, u := range urls {
+		check := widget.NewCheck(u, func(bool) {
+			updateCount()
+		})
+		check.Checked = true
+		checkList.Add(check)
+	}
+	updateCount()
+
+	includeEntry := widget.NewEntry()
+	includeEntry.SetPlaceHolder(t("RegularExpression"))
+	excludeEntry := widget.NewEntry()
+	excludeEntry.SetPlaceHolder(t("RegularExpression"))
+	applyFilter := func(string) {
+		filter, err := newOutlinkFilter(includeEntry.Text, excludeEntry.Text)
+		if err != nil {
+			countLabel.SetText(tWithArgs("InvalidRegularExpression", struct {
+				ERROR string
+			}{ERROR: err.Error()}))
+			return
+		}
+		for i, obj := range checkList.Objects {
+			obj.(*widget.Check).SetChecked(filter.matches(urls[i]))
+		}
+		updateCount()
+	}
+	includeEntry.OnChanged = applyFilter
+	excludeEntry.OnChanged = applyFilter
+
+	filterForm := widget.NewForm(
+		widget.NewFormItem(t("IncludeURLs"), includeEntry),
+		widget.NewFormItem(t("ExcludeURLs"), excludeEntry),
+	)
+	content := container.NewBorder(
+		container.NewVBox(widget.NewLabel(description), filterForm, countLabel),
+		nil, nil, nil,
+		container.NewVScroll(checkList),
+	)
+	selectionDialog := dialog.NewCustomConfirm(title, t("AddToArchive"), t("Cancel"), content, func(b bool) {
+		if !b {
+			return
+		}
+		var selectedURLs []string
+		for i, obj := range checkList.Objects {
+			if obj.(*widget.Check).Checked {
+				selectedURLs = append(selectedURLs, urls[i])
+			}
+		}
+		onConfirm(selectedURLs)
+	}, window)
+	selectionDialog.SetOnClosed(func() {
+		appSessionState.IsSubmissionBlocked.setFalse()
+		appSessionState.IsCloseBlocked.setFalse()
+		window.Resize(windowSize)
+	})
+	window.Resize(fyne.Size{
+		Width:  750,
+		Height: 550,
+	})
+	selectionDialog.Resize(fyne.Size{
+		Width:  700,
+		Height: 500,
+	})
+	selectionDialog.Show()
+}
+
+func updateQueueView() {
+	queueBtn.SetText(tWithArgs("QueueWithCount", struct {
+		Count int
+	}{Count: pendingQueue.size()}))
+	if queueRows == nil {
+		return
+	}
+	queueRows.RemoveAll()
+	items := pendingQueue.snapshot()
+	if len(items) == 0 {
+		queueRows.Add(widget.NewLabel(t("QueueIsEmpty")))
+	}
+	for _, item := range items {
+		itemID := item.ID
+		urlLabel := widget.NewLabel(item.URL)
+		urlLabel.Truncation = fyne.TextTruncateEllipsis
+		statusLabel := widget.NewLabel(queueItemStatusText(item))
+		statusLabel.Wrapping = fyne.TextWrapWord
+		statusLabel.SizeName = theme.SizeNameCaptionText
+
+		retryBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
+			pendingQueue.retry(itemID)
+		})
+		editBtn := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() {
+			showQueueItemEditDialog(itemID, urlLabel.Text)
+		})
+		dropBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+			pendingQueue.remove(itemID)
+		})
+		if item.Status == queueItemSending {
+			retryBtn.Disable()
+			editBtn.Disable()
+			dropBtn.Disable()
+		}
+		queueRows.Add(container.NewBorder(nil, nil, nil, container.NewHBox(retryBtn, editBtn, dropBtn),
+			container.NewVBox(urlLabel, statusLabel)))
+	}
+}
+
+func queueItemStatusText(item queueItem) string {
+	if item.Status == queueItemPending && len(item.Profile) > 0 && item.Profile != activeProfileName {
+		return tWithArgs("QueueItemOtherProfile", struct {
+			NAME string
+		}{NAME: item.Profile})
+	}
+	switch item.Status {
+	case queueItemSending:
+		return t("BatchSending")
+	case queueItemFailed:
+		return tWithArgs("BatchFailed", struct {
+			ERROR string
+		}{ERROR: item.LastError})
+	default:
+		return tWithArgs("QueueItemPending", struct {
+			Attempts  int
+			QueuedAt  string
+			LastError string
+		}{Attempts: item.Attempts, QueuedAt: item.QueuedAt.Format("2006-01-02 15:04"), LastError: item.LastError})
+	}
+}
+
+// list of queued submissions, each can be retried, edited or dropped
+func showQueueDialog() {
+	queueRows = container.NewVBox()
+	updateQueueView()
+
+	replayBtn := widget.NewButtonWithIcon(t("SendQueueNow"), theme.UploadIcon(), func() {
+		go pendingQueue.replay()
+	})
+	appSessionState.IsCloseBlocked.setTrue()
+	appSessionState.IsSubmissionBlocked.setTrue()
+	queueDialog := dialog.NewCustom(t("Queue"), t("Close"),
+		container.NewBorder(nil, replayBtn, nil, nil, container.NewVScroll(queueRows)), window)
+	queueDialog.SetOnClosed(func() {
+		queueRows = nil
+		appSessionState.IsCloseBlocked.setFalse()
+		appSessionState.IsSubmissionBlocked.setFalse()
+		window.Resize(windowSize)
+	})
+	window.Resize(fyne.Size{
+		Width:  750,
+		Height: 550,
+	})
+	queueDialog.Resize(fyne.Size{
+		Width:  700,
+		Height: 500,
+	})
+	queueDialog.Show()
+}
+
+// runs the diagnosis of the connection to the active profile and shows the result of each step
+func showDiagnosticsDialog() {
+	target := currentProfile().instanceTarget
+	endpoint := primarySession().endpoint()
+	rows := container.NewVBox()
+	var report string
+	copyBtn := widget.NewButtonWithIcon(t("CopyReport"), theme.ContentCopyIcon(), func() {
+		window.Clipboard().SetContent(report)
+		infoLabel.SetText(t("ReportCopied"))
+	})
+	var runBtn *widget.Button
+	run := func() {
+		copyBtn.Disable()
+		runBtn.Disable()
+		rows.Objects = []fyne.CanvasObject{widget.NewProgressBarInfinite()}
+		rows.Refresh()
+		go func() {
+			steps := diagnoseConnection(target, endpoint)
+			fyne.Do(func() {
+				rows.Objects = nil
+				for _, step := range steps {
+					icon := theme.ConfirmIcon()
+					if step.Skipped {
+						icon = theme.MediaSkipNextIcon()
+					} else if step.Err != nil {
+						icon = theme.ErrorIcon()
+					}
+					text := diagnosticStepLabel(step.Name)
+					if !step.Skipped {
+						text += fmt.Sprintf(" (%s)", step.Duration.Round(time.Millisecond))
+					}
+					if len(step.Detail) > 0 {
+						text += ": " + step.Detail
+					}
+					if step.Err != nil {
+						text += "\n" + localizeError(step.Err) + "\n" + diagnosticHint(step)
+					}
+					label := widget.NewLabel(text)
+					label.Wrapping = fyne.TextWrapWord
+					rows.Add(container.NewBorder(nil, nil, widget.NewIcon(icon), nil, label))
+				}
+				report = diagnosticsReport(target, endpoint, steps)
+				copyBtn.Enable()
+				runBtn.Enable()
+			})
+		}()
+	}
+	runBtn = widget.NewButtonWithIcon(t("RunAgain"), theme.ViewRefreshIcon(), run)
+
+	appSessionState.IsCloseBlocked.setTrue()
+	appSessionState.IsSubmissionBlocked.setTrue()
+	diagnosticsDialog := dialog.NewCustom(t("Diagnostics"), t("Close"), container.NewBorder(
+		widget.NewLabel(endpoint), container.NewHBox(runBtn, copyBtn), nil, nil, container.NewVScroll(rows)), window)
+	diagnosticsDialog.SetOnClosed(func() {
+		appSessionState.IsCloseBlocked.setFalse()
+		appSessionState.IsSubmissionBlocked.setFalse()
+		window.Resize(windowSize)
+	})
+	window.Resize(fyne.Size{
+		Width:  750,
+		Height: 550,
+	})
+	diagnosticsDialog.Resize(fyne.Size{
+		Width:  700,
+		Height: 500,
+	})
+	diagnosticsDialog.Show()
+	run()
+}
+
+func showQueueItemEditDialog(itemID string, currentURL string) {
+	urlEntry := widget.NewEntry()
+	urlEntry.SetText(currentURL)
+	urlEntry.Validator = func(s string) error {
+		if !isURL(strings.TrimSpace(s)) {
+			return fmt.Errorf("%s", t("InvalidURL"))
+		}
+		return nil
+	}
+	dialog.ShowForm(t("EditQueueItem"), t("Apply"), t("Cancel"),
+		[]*widget.FormItem{widget.NewFormItem(t("URL"), urlEntry)}, func(b bool) {
+			if b {
+				pendingQueue.edit(itemID, strings.TrimSpace(urlEntry.Text))
+			}
+		}, window)
+}
+
+func newParserSelect() *widget.Select {
+	parserSelect := widget.NewSelect(archivebox.Parsers, func(parser string) {
+		fyneApplication.Preferences().SetString(preferenceParser, parser)
+	})
+	parserSelect.SetSelected(fyneApplication.Preferences().StringWithFallback(preferenceParser, archivebox.DefaultParser))
+	return parserSelect
+}
+
+func newProfileSelect() *widget.Select {
+	profileSelect := widget.NewSelect(profileNames(loadProfiles()), nil)
+	profileSelect.SetSelected(activeProfileName)
+	profileSelect.OnChanged = func(name string) {
+		if name == activeProfileName {
+			return
+		}
+		if appSessionState.IsBatchRunning.isSet() {
+			// the running batch is sent to the current instance
+			profileSelect.SetSelected(activeProfileName)
+			return
+		}
+		switchProfile(name)
+	}
+	return profileSelect
+}
+
+func updateInstanceLink() {
+	endpoint := primarySession().endpoint()
+	if currentProfile().TLS.Insecure {
+		instanceLink.SetText(endpoint + " (" + t("TLSInsecure") + ")")
+	} else {
+		instanceLink.SetText(endpoint)
+	}
+	parsedURL, err := url.Parse(endpoint)
+	if err != nil {
+		log.Printf("No valid url to archivebox instance\n")
+		parsedURL = nil
+	}
+	instanceLink.SetURL(parsedURL)
+}
+
+// use the profile in the window, the connection and the tag suggestions are set up again in background
+func switchProfile(name string) {
+	if err := activateProfile(name); err != nil {
+		log.Printf("Problem switching profile: %v\n", err)
+		return
+	}
+	fyneApplication.Preferences().SetString(preferenceActiveProfile, name)
+	profileSelect.SetOptions(profileNames(loadProfiles()))
+	profileSelect.SetSelected(name)
+	updateInstanceLink()
+	tagEntryWidget.SetText(strings.Join(currentProfile().Tags, ", "))
+	archiveMethodsBtn.SetText(archiveMethodsSummary(selectedArchiveMethods, loadArchiveMethodPresets()))
+	infoLabel.SetText("")
+	go func() {
+		setupArchiveBoxConnection()
+		loadTagSuggestions()
+		pendingQueue.replay()
+	}()
+}
+
+// asks for the name of a new profile, the profile is selected and opened in the settings afterwards
+func showNewProfileDialog() {
+	nameEntry := widget.NewEntry()
+	nameEntry.Validator = func(s string) error {
+		name := strings.TrimSpace(s)
+		if len(name) == 0 {
+			return fmt.Errorf("%s", t("ProfileNameMissing"))
+		}
+		if _, ok := loadProfiles()[name]; ok {
+			return fmt.Errorf("%s", t("ProfileNameInUse"))
+		}
+		return nil
+	}
+	dialog.ShowForm(t("NewProfile"), t("Apply"), t("Cancel"),
+		[]*widget.FormItem{widget.NewFormItem(t("ProfileName"), nameEntry)}, func(b bool) {
+			if !b {
+				return
+			}
+			name := strings.TrimSpace(nameEntry.Text)
+			profiles := loadProfiles()
+			profiles[name] = instanceProfile{instanceTarget: instanceTarget{InstanceURL: defaultInstanceURL}}
+			saveProfiles(profiles)
+			switchProfile(name)
+			showSettingsDialog()
+		}, window)
+}
+
+func showDeleteProfileDialog() {
+	profiles := loadProfiles()
+	if len(profiles) < 2 {
+		// the last profile is kept
+		return
+	}
+	dialog.ShowConfirm(t("DeleteProfile"), tWithArgs("DoYouReallyWantToDeleteProfile", struct {
+		NAME string
+	}{NAME: activeProfileName}), func(b bool) {
+		if !b {
+			return
+		}
+		delete(profiles, activeProfileName)
+		saveProfiles(profiles)
+		switchProfile(profileNames(profiles)[0])
+	}, window)
+}
+
+// list of the mirrors of the active profile, changes are stored immediately
+func showMirrorsDialog(onChanged func(mirrors []instanceTarget)) {
+	rows := container.NewVBox()
+	var updateRows func()
+	saveMirrors := func(mirrors []instanceTarget) {
+		updateCurrentProfile(func(profile *instanceProfile) {
+			profile.Mirrors = mirrors
+		})
+		// the sessions are set up again with the changed mirrors
+		go resetInstanceSessions()
+		updateRows()
+		onChanged(mirrors)
+	}
+	updateRows = func() {
+		rows.RemoveAll()
+		mirrors := currentProfile().Mirrors
+		if len(mirrors) == 0 {
+			rows.Add(widget.NewLabel(t("NoMirrors")))
+		}
+		for i, mirror := range mirrors {
+			urlLabel := widget.NewLabel(mirror.InstanceURL)
+			urlLabel.Truncation = fyne.TextTruncateEllipsis
+			editBtn := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() {
+				showMirrorEditDialog(mirror, func(changed instanceTarget) {
+					mirrors[i] = changed
+					saveMirrors(mirrors)
+				})
+			})
+			dropBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+				saveMirrors(append(mirrors[:i:i], mirrors[i+1:]...))
+			})
+			rows.Add(container.NewBorder(nil, nil, nil, container.NewHBox(editBtn, dropBtn), urlLabel))
+		}
+	}
+	updateRows()
+
+	addBtn := widget.NewButtonWithIcon(t("AddMirror"), theme.ContentAddIcon(), func() {
+		showMirrorEditDialog(instanceTarget{}, func(mirror instanceTarget) {
+			saveMirrors(append(currentProfile().Mirrors, mirror))
+		})
+	})
+	mirrorsDialog := dialog.NewCustom(t("Mirrors"), t("Close"),
+		container.NewBorder(nil, addBtn, nil, nil, container.NewVScroll(rows)), window)
+	mirrorsDialog.Resize(fyne.Size{
+		Width:  600,
+		Height: 300,
+	})
+	mirrorsDialog.Show()
+}
+
+// short description of the tls settings for the button opening them
+func tlsSummary(settings tlsSettings) string {
+	var parts []string
+	if len(settings.CAFile) > 0 {
+		parts = append(parts, t("TLSCustomCA"))
+	}
+	if len(settings.CertFile) > 0 {
+		parts = append(parts, t("TLSClientCertificate"))
+	}
+	if len(settings.PinnedKeys) > 0 {
+		parts = append(parts, t("TLSPinning"))
+	}
+	if settings.Insecure {
+		parts = append(parts, t("TLSInsecure"))
+	}
+	if len(parts) == 0 {
+		return t("TLSDefault")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// edit the ca, client certificate and pinning of the connections to an instance
+func showTLSDialog(settings tlsSettings, onSave func(settings tlsSettings)) {
+	caFileEntry := widget.NewEntry()
+	caFileEntry.SetText(settings.CAFile)
+	caFileEntry.SetPlaceHolder(t("TLSCAFileHint"))
+	certFileEntry := widget.NewEntry()
+	certFileEntry.SetText(settings.CertFile)
+	certFileEntry.SetPlaceHolder(t("TLSPEMFileHint"))
+	keyFileEntry := widget.NewEntry()
+	keyFileEntry.SetText(settings.KeyFile)
+	keyFileEntry.SetPlaceHolder(t("TLSPEMFileHint"))
+	pinnedKeysEntry := widget.NewMultiLineEntry()
+	pinnedKeysEntry.SetMinRowsVisible(2)
+	pinnedKeysEntry.SetText(strings.Join(settings.PinnedKeys, "\n"))
+	pinnedKeysEntry.SetPlaceHolder(t("TLSPinnedKeysHint"))
+	insecureCheckbox := widget.NewCheck(t("TLSInsecureLabel"), nil)
+	insecureCheckbox.SetChecked(settings.Insecure)
+	insecureCheckbox.OnChanged = func(checked bool) {
+		if checked {
+			dialog.ShowInformation(t("TLSInsecure"), t("TLSInsecureWarning"), window)
+		}
+	}
+	dialog.ShowForm(t("TLS"), t("Apply"), t("Cancel"), []*widget.FormItem{
+		widget.NewFormItem(t("TLSCAFile"), caFileEntry),
+		widget.NewFormItem(t("TLSCertFile"), certFileEntry),
+		widget.NewFormItem(t("TLSKeyFile"), keyFileEntry),
+		widget.NewFormItem(t("TLSPinnedKeys"), pinnedKeysEntry),
+		widget.NewFormItem("", insecureCheckbox),
+	}, func(b bool) {
+		if !b {
+			return
+		}
+		changed := tlsSettings{
+			CAFile:   strings.TrimSpace(caFileEntry.Text),
+			CertFile: strings.TrimSpace(certFileEntry.Text),
+			KeyFile:  strings.TrimSpace(keyFileEntry.Text),
+			Insecure: insecureCheckbox.Checked,
+		}
+		for _, pinnedKey := range strings.Split(pinnedKeysEntry.Text, "\n") {
+			if pinnedKey = strings.TrimSpace(pinnedKey); len(pinnedKey) > 0 {
+				changed.PinnedKeys = append(changed.PinnedKeys, pinnedKey)
+			}
+		}
+		// e.g. missing files or invalid keys
+		if _, err := archivebox.NewTransport(changed.options()); err != nil {
+			dialog.ShowError(fmt.Errorf("%s", tWithArgs("TLSInvalid", struct {
+				Error string
+			}{Error: err.Error()})), window)
+			return
+		}
+		onSave(changed)
+	}, window)
+}
+
+var proxyModes = []string{proxyModeSystem, proxyModeNone, proxyModeCustom}
+
+func proxyModeLabel(mode string) string {
+	switch mode {
+	case proxyModeNone:
+		return t("ProxyNone")
+	case proxyModeCustom:
+		return t("ProxyCustom")
+	default:
+		return t("ProxySystem")
+	}
+}
+
+// short description of the proxy settings for the button opening them
+func proxySummary(settings proxySettings) string {
+	if settings.Mode == proxyModeCustom {
+		return settings.URL
+	}
+	return proxyModeLabel(settings.Mode)
+}
+
+// edit the proxy of the connections to an instance
+func showProxyDialog(settings proxySettings, onSave func(settings proxySettings)) {
+	var labels []string
+	for _, mode := range proxyModes {
+		labels = append(labels, proxyModeLabel(mode))
+	}
+	modeSelect := widget.NewSelect(labels, nil)
+	urlEntry := widget.NewEntry()
+	urlEntry.SetText(settings.URL)
+	urlEntry.SetPlaceHolder("socks5://127.0.0.1:1080")
+	urlEntry.Validator = func(s string) error {
+		if modeSelect.SelectedIndex() < 0 || proxyModes[modeSelect.SelectedIndex()] != proxyModeCustom {
+			return nil
+		}
+		if err := (archivebox.ProxyOptions{URL: s}).Apply(&http.Transport{}); err != nil || len(strings.TrimSpace(s)) == 0 {
+			return fmt.Errorf("%s", t("InvalidProxyURL"))
+		}
+		return nil
+	}
+	userNameEntry := widget.NewEntry()
+	userNameEntry.SetText(settings.Username)
+	passwordEntry := widget.NewPasswordEntry()
+	if len(settings.Password) > 0 {
+		passwordEntry.SetPlaceHolder(t("AlreadySet"))
+	}
+	noProxyEntry := widget.NewMultiLineEntry()
+	noProxyEntry.SetMinRowsVisible(2)
+	noProxyEntry.SetText(strings.Join(settings.NoProxy, "\n"))
+	noProxyEntry.SetPlaceHolder(t("NoProxyHint"))
+	modeSelect.OnChanged = func(string) {
+		isCustom := proxyModes[modeSelect.SelectedIndex()] == proxyModeCustom
+		for _, entry := range []*widget.Entry{urlEntry, userNameEntry, passwordEntry, noProxyEntry} {
+			if isCustom {
+				entry.Enable()
+			} else {
+				entry.Disable()
+			}
+		}
+		_ = urlEntry.Validate()
+	}
+	modeSelect.SetSelected(proxyModeLabel(settings.Mode))
+
+	dialog.ShowForm(t("Proxy"), t("Apply"), t("Cancel"), []*widget.FormItem{
+		widget.NewFormItem(t("Proxy"), modeSelect),
+		widget.NewFormItem(t("ProxyURL"), urlEntry),
+		widget.NewFormItem(t("Username"), userNameEntry),
+		widget.NewFormItem(t("Password"), passwordEntry),
+		widget.NewFormItem(t("NoProxy"), noProxyEntry),
+	}, func(b bool) {
+		if !b {
+			return
+		}
+		changed := proxySettings{
+			Mode:     proxyModes[modeSelect.SelectedIndex()],
+			URL:      strings.TrimSpace(urlEntry.Text),
+			Username: strings.TrimSpace(userNameEntry.Text),
+			Password: settings.Password,
+		}
+		if inputPw := strings.TrimSpace(passwordEntry.Text); len(inputPw) > 0 {
+			changed.Password = inputPw
+		}
+		if len(changed.Username) == 0 {
+			changed.Password = ""
+		}
+		for _, host := range strings.FieldsFunc(noProxyEntry.Text, func(r rune) bool { return r == '\n' || r == ',' }) {
+			if host = strings.TrimSpace(host); len(host) > 0 {
+				changed.NoProxy = append(changed.NoProxy, host)
+			}
+		}
+		onSave(changed)
+	}, window)
+}
+
+var proxyAuthModes = []archivebox.ProxyAuthMode{archivebox.ProxyAuthNone, archivebox.ProxyAuthBasic,
+	archivebox.ProxyAuthBearer, archivebox.ProxyAuthRemoteUser}
+
+func proxyAuthModeLabel(mode archivebox.ProxyAuthMode) string {
+	switch mode {
+	case archivebox.ProxyAuthBasic:
+		return t("ProxyAuthBasic")
+	case archivebox.ProxyAuthBearer:
+		return t("ProxyAuthBearer")
+	case archivebox.ProxyAuthRemoteUser:
+		return t("ProxyAuthRemoteUser")
+	default:
+		return t("ProxyAuthNone")
+	}
+}
+
+// edit the headers of an authenticating reverse proxy in front of an instance
+func showProxyAuthDialog(settings proxyAuthSettings, onSave func(settings proxyAuthSettings)) {
+	var labels []string
+	for _, mode := range proxyAuthModes {
+		labels = append(labels, proxyAuthModeLabel(mode))
+	}
+	modeSelect := widget.NewSelect(labels, nil)
+	userNameEntry := widget.NewEntry()
+	userNameEntry.SetText(settings.Username)
+	passwordEntry := widget.NewPasswordEntry()
+	if len(settings.Password) > 0 {
+		passwordEntry.SetPlaceHolder(t("AlreadySet"))
+	}
+	tokenEntry := widget.NewPasswordEntry()
+	if len(settings.Token) > 0 {
+		tokenEntry.SetPlaceHolder(t("AlreadySet"))
+	}
+	headerEntry := widget.NewEntry()
+	headerEntry.SetText(settings.Header)
+	headerEntry.SetPlaceHolder(archivebox.DefaultRemoteUserHeader)
+	remoteUserEntry := widget.NewEntry()
+	remoteUserEntry.SetText(settings.RemoteUser)
+	remoteUserEntry.SetPlaceHolder(t("RemoteUserHint"))
+	selectedMode := func() archivebox.ProxyAuthMode {
+		if modeSelect.SelectedIndex() < 0 {
+			return archivebox.ProxyAuthNone
+		}
+		return proxyAuthModes[modeSelect.SelectedIndex()]
+	}
+	modeSelect.OnChanged = func(string) {
+		mode := selectedMode()
+		entries := map[*widget.Entry]bool{
+			userNameEntry:   mode == archivebox.ProxyAuthBasic,
+			passwordEntry:   mode == archivebox.ProxyAuthBasic,
+			tokenEntry:      mode == archivebox.ProxyAuthBearer,
+			headerEntry:     mode == archivebox.ProxyAuthRemoteUser,
+			remoteUserEntry: mode == archivebox.ProxyAuthRemoteUser,
+		}
+		for entry, isEnabled := range entries {
+			if isEnabled {
+				entry.Enable()
+			} else {
+				entry.Disable()
+			}
+		}
+	}
+	modeSelect.SetSelected(proxyAuthModeLabel(settings.Mode))
+
+	dialog.ShowForm(t("ProxyAuth"), t("Apply"), t("Cancel"), []*widget.FormItem{
+		widget.NewFormItem(t("ProxyAuthMode"), modeSelect),
+		widget.NewFormItem(t("Username"), userNameEntry),
+		widget.NewFormItem(t("Password"), passwordEntry),
+		widget.NewFormItem(t("Token"), tokenEntry),
+		widget.NewFormItem(t("RemoteUserHeader"), headerEntry),
+		widget.NewFormItem(t("RemoteUser"), remoteUserEntry),
+	}, func(b bool) {
+		if !b {
+			return
+		}
+		changed := proxyAuthSettings{Mode: selectedMode()}
+		switch changed.Mode {
+		case archivebox.ProxyAuthBasic:
+			changed.Username = strings.TrimSpace(userNameEntry.Text)
+			changed.Password = settings.Password
+			if inputPw := strings.TrimSpace(passwordEntry.Text); len(inputPw) > 0 {
+				changed.Password = inputPw
+			}
+		case archivebox.ProxyAuthBearer:
+			changed.Token = settings.Token
+			if inputToken := strings.TrimSpace(tokenEntry.Text); len(inputToken) > 0 {
+				changed.Token = inputToken
+			}
+		case archivebox.ProxyAuthRemoteUser:
+			changed.Header = strings.TrimSpace(headerEntry.Text)
+			changed.RemoteUser = strings.TrimSpace(remoteUserEntry.Text)
+		}
+		onSave(changed)
+	}, window)
+}
+
+// instance urls may contain a path prefix and omit the port
+func validateInstanceURL(s string) error {
+	if _, err := archivebox.NormalizeURL(s); err != nil {
+		return fmt.Errorf("%s", t("InvalidInstanceURL"))
+	}
+	return nil
+}
+
+// probes the instance in background before the settings are saved, unreachable instances are saved on request,
+// e.g. if the instance is only reachable in another network
+func probeBeforeSave(target instanceTarget, onSave func()) {
+	progress := dialog.NewCustomWithoutButtons(t("CheckingInstance"), widget.NewProgressBarInfinite(), window)
+	progress.Show()
+	go func() {
+		err := probeInstance(target)
+		fyne.Do(func() {
+			progress.Hide()
+			if err == nil {
+				onSave()
+				return
+			}
+			log.Printf("Problem probing '%s': %v\n", target.InstanceURL, err)
+			dialog.ShowConfirm(t("InstanceNotReachable"), tWithArgs("SaveUnreachableInstance", struct {
+				URL   string
+				Error string
+			}{URL: target.InstanceURL, Error: localizeError(err)}), func(b bool) {
+				if b {
+					onSave()
+				}
+			}, window)
+		})
+	}()
+}
+
+// multi line entry of the alternative urls of an instance
+func newAlternativeURLsEntry(alternativeURLs []string) *widget.Entry {
+	alternativeURLsEntry := widget.NewMultiLineEntry()
+	alternativeURLsEntry.SetMinRowsVisible(2)
+	alternativeURLsEntry.SetText(strings.Join(alternativeURLs, "\n"))
+	alternativeURLsEntry.SetPlaceHolder(t("AlternativeURLsHint"))
+	alternativeURLsEntry.Validator = func(text string) error {
+		for _, alternativeURL := range parseAlternativeURLs(text) {
+			if validateInstanceURL(alternativeURL) != nil {
+				return fmt.Errorf("%s", tWithArgs("InvalidAlternativeURL", struct {
+					URL string
+				}{URL: alternativeURL}))
+			}
+		}
+		return nil
+	}
+	return alternativeURLsEntry
+}
+
+func showMirrorEditDialog(mirror instanceTarget, onSave func(mirror instanceTarget)) {
+	instanceURLEntry := widget.NewEntry()
+	instanceURLEntry.SetText(mirror.InstanceURL)
+	instanceURLEntry.SetPlaceHolder(t("InstanceURLHint"))
+	instanceURLEntry.Validator = validateInstanceURL
+	userNameEntry := widget.NewEntry()
+	userNameEntry.SetText(mirror.Username)
+	passwordEntry := widget.NewPasswordEntry()
+	if len(mirror.Password) > 0 {
+		passwordEntry.SetPlaceHolder(t("AlreadySet"))
+	}
+	apiKeyEntry := widget.NewPasswordEntry()
+	apiKeyEntry.SetText(mirror.APIKey)
+	apiKeyEntry.SetPlaceHolder(t("APIKeyHint"))
+	alternativeURLsEntry := newAlternativeURLsEntry(mirror.AlternativeURLs)
+	tlsBtn := widget.NewButtonWithIcon(tlsSummary(mirror.TLS), theme.AccountIcon(), nil)
+	tlsBtn.OnTapped = func() {
+		showTLSDialog(mirror.TLS, func(changed tlsSettings) {
+			mirror.TLS = changed
+			tlsBtn.SetText(tlsSummary(changed))
+		})
+	}
+	proxyBtn := widget.NewButtonWithIcon(proxySummary(mirror.Proxy), theme.ComputerIcon(), nil)
+	proxyBtn.OnTapped = func() {
+		showProxyDialog(mirror.Proxy, func(changed proxySettings) {
+			mirror.Proxy = changed
+			proxyBtn.SetText(proxySummary(changed))
+		})
+	}
+	proxyAuthBtn := widget.NewButtonWithIcon(proxyAuthModeLabel(mirror.ProxyAuth.Mode), theme.LoginIcon(), nil)
+	proxyAuthBtn.OnTapped = func() {
+		showProxyAuthDialog(mirror.ProxyAuth, func(changed proxyAuthSettings) {
+			mirror.ProxyAuth = changed
+			proxyAuthBtn.SetText(proxyAuthModeLabel(changed.Mode))
+		})
+	}
+	dialog.ShowForm(t("EditMirror"), t("Apply"), t("Cancel"), []*widget.FormItem{
+		widget.NewFormItem(t("ArchiveBoxURL"), instanceURLEntry),
+		widget.NewFormItem(t("AlternativeURLs"), alternativeURLsEntry),
+		widget.NewFormItem(t("Username"), userNameEntry),
+		widget.NewFormItem(t("Password"), passwordEntry),
+		widget.NewFormItem(t("APIKey"), apiKeyEntry),
+		widget.NewFormItem(t("TLS"), tlsBtn),
+		widget.NewFormItem(t("Proxy"), proxyBtn),
+		widget.NewFormItem(t("ProxyAuth"), proxyAuthBtn),
+	}, func(b bool) {
+		if !b {
+			return
+		}
+		mirror.InstanceURL = normalizeInstanceURL(instanceURLEntry.Text)
+		mirror.AlternativeURLs = parseAlternativeURLs(alternativeURLsEntry.Text)
+		mirror.Username = strings.TrimSpace(userNameEntry.Text)
+		if inputPw := strings.TrimSpace(passwordEntry.Text); len(inputPw) > 0 {
+			mirror.Password = inputPw
+		}
+		mirror.APIKey = strings.TrimSpace(apiKeyEntry.Text)
+		probeBeforeSave(mirror, func() {
+			onSave(mirror)
+		})
+	}, window)
+}
+
+// lets the user pick the archive methods of the next submissions and manage named presets of them
+func showArchiveMethodsDialog() {
+	presets := loadArchiveMethodPresets()
+
+	methodChecks := make([]fyne.CanvasObject, 0, len(archivebox.ArchiveMethods))
+	setCheckedMethods := func(methods []string) {
+		for i, obj := range methodChecks {
+			isChecked := false
+			for _, m := range methods {
+				if m == archivebox.ArchiveMethods[i] {
+					isChecked = true
+				}
+			}
+			obj.(*widget.Check).SetChecked(isChecked)
+		}
+	}
+	checkedMethods := func() []string {
+		var methods []string
+		for i, obj := range methodChecks {
+			if obj.(*widget.Check).Checked {
+				methods = append(methods, archivebox.ArchiveMethods[i])
+			}
+		}
+		return methods
+	}
+	for _, method := range archivebox.ArchiveMethods {
+		methodChecks = append(methodChecks, widget.NewCheck(method, func(bool) {}))
+	}
+	setCheckedMethods(selectedArchiveMethods)
+
+	presetNameEntry := widget.NewEntry()
+	presetNameEntry.SetPlaceHolder(t("PresetName"))
+	presetSelect := widget.NewSelect(archiveMethodPresetNames(presets), func(name string) {
+		setCheckedMethods(presets[name])
+		presetNameEntry.SetText(name)
+	})
+	presetSelect.PlaceHolder = t("SelectPreset")
+	savePresetBtn := widget.NewButtonWithIcon(t("SavePreset"), theme.DocumentSaveIcon(), func() {
+		name := strings.TrimSpace(presetNameEntry.Text)
+		if len(name) == 0 {
+			return
+		}
+		presets[name] = checkedMethods()
+		saveArchiveMethodPresets(presets)
+		presetSelect.SetOptions(archiveMethodPresetNames(presets))
+		presetSelect.SetSelected(name)
+	})
+	deletePresetBtn := widget.NewButtonWithIcon(t("DeletePreset"), theme.DeleteIcon(), func() {
+		if _, ok := presets[presetSelect.Selected]; !ok {
+			return
+		}
+		delete(presets, presetSelect.Selected)
+		saveArchiveMethodPresets(presets)
+		presetSelect.ClearSelected()
+		presetSelect.SetOptions(archiveMethodPresetNames(presets))
+		presetNameEntry.SetText("")
+	})
+	allMethodsBtn := widget.NewButton(t("AllArchiveMethods"), func() {
+		setCheckedMethods(nil)
+	})
+
+	content := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel(t("Preset")), deletePresetBtn, presetSelect),
+		container.NewGridWithColumns(3, methodChecks...),
+		widget.NewLabel(t("NoArchiveMethodSelected")),
+		allMethodsBtn,
+		container.NewBorder(nil, nil, nil, savePresetBtn, presetNameEntry),
+	)
+
+	appSessionState.IsCloseBlocked.setTrue()
+	appSessionState.IsSubmissionBlocked.setTrue()
+	methodsDialog := dialog.NewCustomConfirm(t("ArchiveMethods"), t("Apply"), t("Cancel"), content, func(b bool) {
+		if b {
+			saveSelectedArchiveMethods(checkedMethods())
+			archiveMethodsBtn.SetText(archiveMethodsSummary(selectedArchiveMethods, presets))
+		}
+	}, window)
+	methodsDialog.SetOnClosed(func() {
+		appSessionState.IsCloseBlocked.setFalse()
+		appSessionState.IsSubmissionBlocked.setFalse()
+		window.Resize(windowSize)
+	})
+	window.Resize(fyne.Size{
+		Width:  750,
+		Height: 500,
+	})
+	methodsDialog.Show()
+}
+
 func showSettingsDialog() {
+	if isCredentialStoreLocked() {
+		// secrets entered in the settings must not end up in the preferences
+		showUnlockCredentialsDialog(func() {
+			switchProfile(activeProfileName)
+			showSettingsDialog()
+		})
+		return
+	}
 	var items []*widget.FormItem
+	profile := currentProfile()
+	profileNameEntry := widget.NewEntry()
+	profileNameEntry.Text = activeProfileName
+	profileNameEntry.Validator = func(s string) error {
+		name := strings.TrimSpace(s)
+		if len(name) == 0 {
+			return fmt.Errorf("%s", t("ProfileNameMissing"))
+		}
+		if _, ok := loadProfiles()[name]; ok && name != activeProfileName {
+			return fmt.Errorf("%s", t("ProfileNameInUse"))
+		}
+		return nil
+	}
+	var settingsDialog *dialog.FormDialog
+	newProfileBtn := widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() {
+		settingsDialog.Hide()
+		showNewProfileDialog()
+	})
+	deleteProfileBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		settingsDialog.Hide()
+		showDeleteProfileDialog()
+	})
+	if len(loadProfiles()) < 2 {
+		deleteProfileBtn.Disable()
+	}
+	items = append(items, widget.NewFormItem(t("Profile"),
+		container.NewBorder(nil, nil, nil, container.NewHBox(newProfileBtn, deleteProfileBtn), profileNameEntry)))
+
 	instanceURLEntry := widget.NewEntry()
-	instanceURLEntry.Text = fyneApplication.Preferences().StringWithFallback(preferenceInstanceURL, "http://127.0.0.1:8000")
-	instanceURLEntry.Validator = validation.NewRegexp("^http[s]?://.*:[0-9]{1,5}$", "invalid URL")
+	instanceURLEntry.Text = profile.InstanceURL
+	instanceURLEntry.SetPlaceHolder(t("InstanceURLHint"))
+	instanceURLEntry.Validator = validateInstanceURL
 	items = append(items, widget.NewFormItem(t("ArchiveBoxURL"), instanceURLEntry))
 
+	alternativeURLsEntry := newAlternativeURLsEntry(profile.AlternativeURLs)
+	items = append(items, widget.NewFormItem(t("AlternativeURLs"), alternativeURLsEntry))
+
 	userNameEntry := widget.NewEntry()
-	userNameEntry.Text = fyneApplication.Preferences().StringWithFallback(preferenceUsername, "")
-	userNameEntry.Validator = validation.NewRegexp("^\\s*\\S{2,}\\s*$", "too short")
+	userNameEntry.Text = profile.Username
+	// without username the public add form of the instance is used
+	userNameEntry.Validator = validation.NewRegexp("^\\s*(\\S{2,})?\\s*$", "too short")
+	userNameEntry.SetPlaceHolder(t("UsernameHint"))
 	items = append(items, widget.NewFormItem(t("Username"), userNameEntry))
 
 	passwordEntry := widget.NewPasswordEntry()
 	passwordEntry.ActionItem = nil
-	currentPw := fyneApplication.Preferences().StringWithFallback(preferencePassword, "")
+	currentPw := profile.Password
 	if len(currentPw) > 0 {
 		passwordEntry.SetPlaceHolder(t("AlreadySet"))
-		passwordEntry.OnChanged = func(s string) {
-			if len(strings.TrimSpace(s)) > 0 && passwordEntry.Validator == nil {
-				passwordEntry.Validator = validation.NewRegexp("^\\s*\\S{2,}\\s*$", "too short")
-			} else {
-				passwordEntry = nil
-			}
+	}
+	isPasswordValid := validation.NewRegexp("^\\s*\\S{2,}\\s*$", "too short")
+	passwordEntry.Validator = func(s string) error {
+		if len(strings.TrimSpace(s)) > 0 {
+			return isPasswordValid(s)
 		}
-	} else {
-		passwordEntry.Validator = validation.NewRegexp("^\\s*\\S{2,}\\s*$", "too short")
+		// the current password is kept, the instance is used anonymously or the proxy logs in the user
+		if len(currentPw) > 0 || len(strings.TrimSpace(userNameEntry.Text)) == 0 ||
+			profile.ProxyAuth.Mode == archivebox.ProxyAuthRemoteUser {
+			return nil
+		}
+		return isPasswordValid(s)
+	}
+	userNameEntry.OnChanged = func(string) {
+		_ = passwordEntry.Validate()
 	}
 	items = append(items, widget.NewFormItem(t("Password"), passwordEntry))
 
+	apiKeyEntry := widget.NewPasswordEntry()
+	apiKeyEntry.Text = profile.APIKey
+	apiKeyEntry.SetPlaceHolder(t("APIKeyHint"))
+	items = append(items, widget.NewFormItem(t("APIKey"), apiKeyEntry))
+
+	mirrorsBtn := widget.NewButtonWithIcon(tWithArgs("MirrorsWithCount", struct {
+		Count int
+	}{Count: len(profile.Mirrors)}), theme.StorageIcon(), nil)
+	mirrorsBtn.OnTapped = func() {
+		showMirrorsDialog(func(mirrors []instanceTarget) {
+			mirrorsBtn.SetText(tWithArgs("MirrorsWithCount", struct {
+				Count int
+			}{Count: len(mirrors)}))
+		})
+	}
+	items = append(items, widget.NewFormItem(t("Mirrors"), mirrorsBtn))
+
+	tlsBtn := widget.NewButtonWithIcon(tlsSummary(profile.TLS), theme.AccountIcon(), nil)
+	tlsBtn.OnTapped = func() {
+		showTLSDialog(profile.TLS, func(changed tlsSettings) {
+			profile.TLS = changed
+			tlsBtn.SetText(tlsSummary(changed))
+		})
+	}
+	items = append(items, widget.NewFormItem(t("TLS"), tlsBtn))
+
+	proxyBtn := widget.NewButtonWithIcon(proxySummary(profile.Proxy), theme.ComputerIcon(), nil)
+	proxyBtn.OnTapped = func() {
+		showProxyDialog(profile.Proxy, func(changed proxySettings) {
+			profile.Proxy = changed
+			proxyBtn.SetText(proxySummary(changed))
+		})
+	}
+	items = append(items, widget.NewFormItem(t("Proxy"), proxyBtn))
+
+	proxyAuthBtn := widget.NewButtonWithIcon(proxyAuthModeLabel(profile.ProxyAuth.Mode), theme.LoginIcon(), nil)
+	proxyAuthBtn.OnTapped = func() {
+		showProxyAuthDialog(profile.ProxyAuth, func(changed proxyAuthSettings) {
+			profile.ProxyAuth = changed
+			proxyAuthBtn.SetText(proxyAuthModeLabel(changed.Mode))
+			// the proxy may log in the user, then the password of the admin form is not needed
+			_ = passwordEntry.Validate()
+		})
+	}
+	items = append(items, widget.NewFormItem(t("ProxyAuth"), proxyAuthBtn))
+
+	credentialStoreBtn := widget.NewButtonWithIcon(credentialStoreLabel(credentialStoreKind()), theme.VisibilityOffIcon(), nil)
+	credentialStoreBtn.OnTapped = func() {
+		showCredentialStoreDialog(func(kind string) {
+			credentialStoreBtn.SetText(credentialStoreLabel(kind))
+		})
+	}
+	items = append(items, widget.NewFormItem(t("CredentialStore"), credentialStoreBtn))
+
+	defaultTagsEntry := widget.NewEntry()
+	defaultTagsEntry.Text = strings.Join(profile.Tags, ", ")
+	defaultTagsEntry.SetPlaceHolder(t("DefaultTagsHint"))
+	items = append(items, widget.NewFormItem(t("DefaultTags"), defaultTagsEntry))
+
 	borderlessCheckbox := widget.NewCheck("", func(b bool) {})
 	isBorderless := fyneApplication.Preferences().BoolWithFallback(preferenceBorderless, true)
 	borderlessCheckbox.Checked = isBorderless
@@ -81,11 +1124,29 @@ func showSettingsDialog() {
 	linkAddCheckCheckbox.Checked = isAddChecked
 	items = append(items, widget.NewFormItem(t("CheckIfURLWasAdded"), linkAddCheckCheckbox))
 
+	stayLoggedInCheckbox := widget.NewCheck("", func(b bool) {})
+	stayLoggedInCheckbox.Checked = isStayLoggedIn()
+	items = append(items, widget.NewFormItem(t("StayLoggedIn"), stayLoggedInCheckbox))
+
+	confirmSubmissionCheckbox := widget.NewCheck("", func(b bool) {})
+	confirmSubmissionCheckbox.Checked = fyneApplication.Preferences().BoolWithFallback(preferenceConfirmSubmission, false)
+	items = append(items, widget.NewFormItem(t("ConfirmSubmission"), confirmSubmissionCheckbox))
+
 	closeAfterAddCheckbox := widget.NewCheck("", func(b bool) {})
 	isCloseAfterAdd := fyneApplication.Preferences().BoolWithFallback(preferenceCloseAfterAdd, false)
 	closeAfterAddCheckbox.Checked = isCloseAfterAdd
 	items = append(items, widget.NewFormItem(t("CloseAppAfterArchiving"), closeAfterAddCheckbox))
 
+	maxRetriesEntry := widget.NewEntry()
+	maxRetriesEntry.Text = strconv.Itoa(fyneApplication.Preferences().IntWithFallback(preferenceMaxRetries, defaultMaxRetries))
+	maxRetriesEntry.Validator = validation.NewRegexp("^([0-9]|10)$", "0-10")
+	items = append(items, widget.NewFormItem(t("MaxRetries"), maxRetriesEntry))
+
+	retryBaseDelayEntry := widget.NewEntry()
+	retryBaseDelayEntry.Text = strconv.Itoa(fyneApplication.Preferences().IntWithFallback(preferenceRetryBaseDelay, defaultRetryBaseDelay))
+	retryBaseDelayEntry.Validator = validation.NewRegexp("^([0-9]|[1-5][0-9]|60)$", "0-60")
+	items = append(items, widget.NewFormItem(t("RetryBaseDelay"), retryBaseDelayEntry))
+
 	newSettings := settings.NewSettings()
 	appearanceBtn := widget.NewButtonWithIcon("", newSettings.AppearanceIcon(), func() {
 		// open fine settings
@@ -95,19 +1156,47 @@ func showSettingsDialog() {
 
 	appSessionState.IsCloseBlocked.setTrue()
 	appSessionState.IsSubmissionBlocked.setTrue()
-	settingsDialog := dialog.NewForm(t("Settings"), t("Apply"), t("Cancel"), items, func(b bool) {
-		if b {
+	settingsDialog = dialog.NewForm(t("Settings"), t("Apply"), t("Cancel"), items, func(b bool) {
+		if !b {
+			return
+		}
+		profile.InstanceURL = normalizeInstanceURL(instanceURLEntry.Text)
+		profile.AlternativeURLs = parseAlternativeURLs(alternativeURLsEntry.Text)
+		profile.Username = strings.TrimSpace(userNameEntry.Text)
+		inputPw := strings.TrimSpace(passwordEntry.Text)
+		if len(inputPw) > 0 {
+			profile.Password = inputPw
+		}
+		if len(profile.Username) == 0 {
+			profile.Password = ""
+		}
+		profile.APIKey = strings.TrimSpace(apiKeyEntry.Text)
+		profile.Tags = parseTags(defaultTagsEntry.Text)
+		probeBeforeSave(profile.instanceTarget, func() {
 			log.Printf("Updating preferences! \n")
-			fyneApplication.Preferences().SetString(preferenceInstanceURL, strings.TrimSpace(instanceURLEntry.Text))
-			fyneApplication.Preferences().SetString(preferenceUsername, strings.TrimSpace(userNameEntry.Text))
-			inputPw := strings.TrimSpace(passwordEntry.Text)
-			if len(inputPw) > 0 {
-				fyneApplication.Preferences().SetString(preferencePassword, inputPw)
-			}
+			// the mirrors are stored by their own dialog
+			profile.Mirrors = currentProfile().Mirrors
+			profiles := loadProfiles()
+			delete(profiles, activeProfileName)
+			profiles[strings.TrimSpace(profileNameEntry.Text)] = profile
+			saveProfiles(profiles)
 			fyneApplication.Preferences().SetBool(preferenceBorderless, borderlessCheckbox.Checked)
 			fyneApplication.Preferences().SetBool(preferenceCheckAdd, linkAddCheckCheckbox.Checked)
 			fyneApplication.Preferences().SetBool(preferenceCloseAfterAdd, closeAfterAddCheckbox.Checked)
-		}
+			fyneApplication.Preferences().SetBool(preferenceConfirmSubmission, confirmSubmissionCheckbox.Checked)
+			if isStayLoggedIn() && !stayLoggedInCheckbox.Checked {
+				storedSessions.clear()
+			}
+			fyneApplication.Preferences().SetBool(preferenceStayLoggedIn, stayLoggedInCheckbox.Checked)
+			if maxRetries, err := strconv.Atoi(maxRetriesEntry.Text); err == nil {
+				fyneApplication.Preferences().SetInt(preferenceMaxRetries, maxRetries)
+			}
+			if retryBaseDelay, err := strconv.Atoi(retryBaseDelayEntry.Text); err == nil {
+				fyneApplication.Preferences().SetInt(preferenceRetryBaseDelay, retryBaseDelay)
+			}
+			// the connection is set up again with the changed profile
+			switchProfile(strings.TrimSpace(profileNameEntry.Text))
+		})
 	}, window)
 
 	window.Resize(fyne.Size{
@@ -127,6 +1216,97 @@ func showSettingsDialog() {
 	settingsDialog.Show()
 }
 
+// asks for the master passphrase of the credential file, the profile is loaded again with its secrets afterwards
+func showUnlockCredentialsDialog(onUnlocked func()) {
+	passphraseEntry := widget.NewPasswordEntry()
+	appSessionState.IsSubmissionBlocked.setTrue()
+	unlockDialog := dialog.NewForm(t("UnlockCredentials"), t("Unlock"), t("Cancel"), []*widget.FormItem{
+		widget.NewFormItem(t("MasterPassphrase"), passphraseEntry),
+	}, func(b bool) {
+		if !b {
+			infoLabel.SetText(t("CredentialsLocked"))
+			return
+		}
+		if err := unlockCredentials(passphraseEntry.Text); err != nil {
+			log.Printf("Problem unlocking credentials: %v\n", err)
+			errorDialog := dialog.NewError(fmt.Errorf("%s", localizeError(err)), window)
+			errorDialog.SetOnClosed(func() {
+				showUnlockCredentialsDialog(onUnlocked)
+			})
+			errorDialog.Show()
+			return
+		}
+		onUnlocked()
+	}, window)
+	unlockDialog.SetOnClosed(func() {
+		appSessionState.IsSubmissionBlocked.setFalse()
+	})
+	unlockDialog.Show()
+	window.Canvas().Focus(passphraseEntry)
+}
+
+var credentialStoreKinds = []string{credentialStoreAuto, credentialStoreSecretService, credentialStoreKeyFile, credentialStorePassphrase}
+
+func credentialStoreLabel(kind string) string {
+	switch kind {
+	case credentialStoreSecretService:
+		return t("CredentialStoreSecretService")
+	case credentialStoreKeyFile:
+		return t("CredentialStoreKeyFile")
+	case credentialStorePassphrase:
+		return t("CredentialStorePassphrase")
+	default:
+		return t("CredentialStoreAuto")
+	}
+}
+
+// lets the user choose where passwords and api keys are stored, the secrets are moved to the chosen store
+func showCredentialStoreDialog(onChanged func(kind string)) {
+	var labels []string
+	for _, kind := range credentialStoreKinds {
+		labels = append(labels, credentialStoreLabel(kind))
+	}
+	kindSelect := widget.NewSelect(labels, nil)
+	kindSelect.SetSelected(credentialStoreLabel(credentialStoreKind()))
+	keyFileEntry := widget.NewEntry()
+	keyFileEntry.SetText(fyneApplication.Preferences().StringWithFallback(preferenceCredentialKeyFile, ""))
+	keyFileEntry.SetPlaceHolder(credentialKeyFilePath())
+	passphraseEntry := widget.NewPasswordEntry()
+	passphraseEntry.SetPlaceHolder(t("MasterPassphraseHint"))
+	passphraseRepeatEntry := widget.NewPasswordEntry()
+	passphraseRepeatEntry.Validator = func(s string) error {
+		if s != passphraseEntry.Text {
+			return fmt.Errorf("%s", t("PassphrasesDiffer"))
+		}
+		return nil
+	}
+	keyFileItem := widget.NewFormItem(t("KeyFile"), keyFileEntry)
+	keyFileItem.HintText = t("KeyFileHint")
+	dialog.ShowForm(t("CredentialStore"), t("Apply"), t("Cancel"), []*widget.FormItem{
+		widget.NewFormItem(t("CredentialStore"), kindSelect),
+		keyFileItem,
+		widget.NewFormItem(t("MasterPassphrase"), passphraseEntry),
+		widget.NewFormItem(t("RepeatPassphrase"), passphraseRepeatEntry),
+	}, func(b bool) {
+		if !b {
+			return
+		}
+		kind := credentialStoreKinds[kindSelect.SelectedIndex()]
+		keyFilePath := strings.TrimSpace(keyFileEntry.Text)
+		if len(keyFilePath) == 0 {
+			keyFilePath = filepath.Join(fyneApplication.Storage().RootURI().Path(), credentialKeyFileName)
+		}
+		if err := switchCredentialStore(kind, keyFilePath, passphraseEntry.Text); err != nil {
+			log.Printf("Problem changing the credential store: %v\n", err)
+			dialog.ShowError(fmt.Errorf("%s", localizeError(err)), window)
+			return
+		}
+		fyneApplication.Preferences().SetString(preferenceCredentialStore, kind)
+		fyneApplication.Preferences().SetString(preferenceCredentialKeyFile, strings.TrimSpace(keyFileEntry.Text))
+		onChanged(kind)
+	}, window)
+}
+
 func showFyneSettingsWindow() {
 	if isAppearanceWindowOpen {
 		return
@@ -173,3 +1353,23 @@ func (s *URLInputField) TypedShortcut(shortcut fyne.Shortcut) {
 		s.Entry.TypedShortcut(shortcut)
 	}
 }
+
+// TagInputField entry for comma separated tags, suggests the tags already known by the instance
+type TagInputField struct {
+	*widget.SelectEntry
+	knownTags []string
+}
+
+func newTagInputField() *TagInputField {
+	entry := &TagInputField{SelectEntry: widget.NewSelectEntry(nil)}
+	entry.SetPlaceHolder(t("EnterTags"))
+	entry.OnChanged = func(s string) {
+		entry.SetOptions(tagSuggestions(s, entry.knownTags))
+	}
+	return entry
+}
+
+func (s *TagInputField) setKnownTags(tags []string) {
+	s.knownTags = tags
+	s.SetOptions(tagSuggestions(s.Text, s.knownTags))
+}
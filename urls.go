@@ -0,0 +1,57 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var urlInTextPattern = regexp.MustCompile("(?i)https?://[^\\s<>\"'`]+")
+
+// find all unique http(s) urls in arbitrary text like emails, chat logs or markdown notes
+func extractURLs(text string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, match := range urlInTextPattern.FindAllString(text, -1) {
+		u := trimURLSuffix(match)
+		if !isURL(u) || seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// remove trailing punctuation and unbalanced closing brackets, e.g. of markdown links or sentences
+func trimURLSuffix(u string) string {
+	for len(u) > 0 {
+		last := u[len(u)-1]
+		switch {
+		case strings.IndexByte(".,;:!?*", last) >= 0:
+			u = u[:len(u)-1]
+		case last == ')' && strings.Count(u, "(") < strings.Count(u, ")"),
+			last == ']' && strings.Count(u, "[") < strings.Count(u, "]"),
+			last == '}' && strings.Count(u, "{") < strings.Count(u, "}"):
+			u = u[:len(u)-1]
+		default:
+			return u
+		}
+	}
+	return u
+}
@@ -0,0 +1,41 @@
+// archivebox-quick-add
+// 2022 emschu[aet]mailbox.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public
+// License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractURLs(t *testing.T) {
+	text := `Hi, please read https://example.org/post. and [this](https://en.wikipedia.org/wiki/Go_(programming_language))!
+> quoted: <https://example.org/post>, "https://other.org/?q=1&p=2"
+ftp://ignored.org and http://a.org/b),`
+	urls := extractURLs(text)
+	expected := []string{
+		"https://example.org/post",
+		"https://en.wikipedia.org/wiki/Go_(programming_language)",
+		"https://other.org/?q=1&p=2",
+		"http://a.org/b",
+	}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected %v, got %v", expected, urls)
+	}
+	if len(extractURLs("no links here")) != 0 {
+		t.Error("Expected no urls")
+	}
+}